@@ -7,18 +7,7 @@ import (
 	"github.com/highras/fpnn-sdk-go/src/fpnn"
 )
 
-type DemoQuestPeocessor struct {}
-
-func (processor *DemoQuestPeocessor) Process(method string) func(*fpnn.Quest) (*fpnn.Answer, error) {
-	if method == "duplexQuest" {
-		return processor.duplexQuest
-	} else {
-		fmt.Println("Receive unknown method:", method)
-		return nil
-	}
-}
-
-func (processor *DemoQuestPeocessor) duplexQuest(quest *fpnn.Quest) (*fpnn.Answer, error) {
+func duplexQuest(quest *fpnn.Quest) (*fpnn.Answer, error) {
 
 	value, _ := quest.GetInt("int")
 	fmt.Println("Receive server push. value of key 'int' is", value)
@@ -35,7 +24,11 @@ func main() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
 	client := fpnn.NewTCPClient(os.Args[1])
-	client.SetQuestProcessor(&DemoQuestPeocessor{})
+
+	router := fpnn.NewQuestRouter()
+	router.Handle("duplexQuest", duplexQuest)
+
+	client.SetQuestProcessor(router)
 
 	quest := fpnn.NewQuest("duplex demo")
 	quest.Param("duplex method", "duplexQuest")
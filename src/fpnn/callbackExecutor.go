@@ -0,0 +1,216 @@
+package fpnn
+
+import (
+	"sync"
+)
+
+/*
+CallbackExecutor runs answer callbacks, including the timeout and connection closed exceptions.
+
+Execute may block to apply back pressure, but it must run every task it accepts.
+*/
+type CallbackExecutor interface {
+	Execute(task func())
+}
+
+//-----------------[ goroutine executor ]-----------------//
+
+// Default executor: one goroutine per answer, which is tracked by the client, so Close() waits for the callbacks.
+type groupExecutor struct {
+	group *goroutineGroup
+}
+
+func (executor groupExecutor) Execute(task func()) {
+	executor.group.start(func() {
+		executor.group.call(task)
+	})
+}
+
+//-----------------[ inline executor ]-----------------//
+
+type inlineExecutor struct{}
+
+func (inlineExecutor) Execute(task func()) {
+	task()
+}
+
+// Inline executor of a connection. The callbacks run in the goroutines of the client, as user code.
+type groupInlineExecutor struct {
+	group *goroutineGroup
+}
+
+func (executor groupInlineExecutor) Execute(task func()) {
+	executor.group.call(task)
+}
+
+/*
+Callbacks run on the goroutine which received the answer, e.g. the read loop of the connection.
+The callbacks must be fast, and must not call the synchronous SendQuest() of the same client.
+*/
+func NewInlineCallbackExecutor() CallbackExecutor {
+	return inlineExecutor{}
+}
+
+//-----------------[ pool executor ]-----------------//
+
+type PoolCallbackExecutor struct {
+	mutex     sync.RWMutex
+	tasks     chan func()
+	closing   chan struct{}
+	closeOnce sync.Once
+	closed    bool
+}
+
+/*
+Params:
+
+	workers:	count of worker goroutines. Less than 1 means 1.
+	queueSize:	tasks waiting for workers. Execute() blocks when the queue is full.
+*/
+func NewPoolCallbackExecutor(workers int, queueSize int) *PoolCallbackExecutor {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	executor := &PoolCallbackExecutor{
+		tasks:   make(chan func(), queueSize),
+		closing: make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		go executor.workLoop()
+	}
+	return executor
+}
+
+func (executor *PoolCallbackExecutor) workLoop() {
+	for task := range executor.tasks {
+		task()
+	}
+}
+
+func (executor *PoolCallbackExecutor) Execute(task func()) {
+	executor.mutex.RLock()
+	defer executor.mutex.RUnlock()
+
+	if executor.closed {
+		go task()
+		return
+	}
+
+	select {
+	case executor.tasks <- task:
+	case <-executor.closing:
+		go task()
+	}
+}
+
+/*
+Workers exit after the queued tasks are done. Tasks executed after Close() run in their own goroutines.
+*/
+func (executor *PoolCallbackExecutor) Close() {
+	//-- Wake up the blocked Execute() calls first, so they release the read lock.
+	executor.closeOnce.Do(func() {
+		close(executor.closing)
+	})
+
+	executor.mutex.Lock()
+	defer executor.mutex.Unlock()
+
+	if !executor.closed {
+		executor.closed = true
+		close(executor.tasks)
+	}
+}
+
+//-----------------[ serial executor ]-----------------//
+
+// Runs tasks one by one in submitting order, on the underlying executor.
+type serialExecutor struct {
+	mutex    sync.Mutex
+	executor CallbackExecutor
+	tasks    []func()
+	running  bool
+}
+
+func newSerialExecutor(executor CallbackExecutor) *serialExecutor {
+	return &serialExecutor{executor: executor}
+}
+
+func (serial *serialExecutor) Execute(task func()) {
+	serial.mutex.Lock()
+	serial.tasks = append(serial.tasks, task)
+	if serial.running {
+		serial.mutex.Unlock()
+		return
+	}
+	serial.running = true
+	serial.mutex.Unlock()
+
+	serial.executor.Execute(serial.drain)
+}
+
+func (serial *serialExecutor) drain() {
+	for {
+		serial.mutex.Lock()
+		if len(serial.tasks) == 0 {
+			serial.running = false
+			serial.mutex.Unlock()
+			return
+		}
+
+		task := serial.tasks[0]
+		serial.tasks[0] = nil
+		serial.tasks = serial.tasks[1:]
+		serial.mutex.Unlock()
+
+		task()
+	}
+}
+
+//-----------------[ TCPClient callback executor ]-----------------//
+
+/*
+Set nil executor to restore the default executor, which starts a goroutine for each answer.
+*/
+func (client *TCPClient) SetCallbackExecutor(executor CallbackExecutor) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.executor = executor
+	client.offlineQueue.setExecutor(executor)
+	if client.conn != nil {
+		client.conn.setExecutor(client.connectionExecutor())
+	}
+}
+
+/*
+If ordered is true, answer callbacks of a connection are called one by one, in the order of the answers received.
+*/
+func (client *TCPClient) SetOrderedAnswerCallbacks(ordered bool) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.orderedAnswers = ordered
+	if client.conn != nil {
+		client.conn.setExecutor(client.connectionExecutor())
+	}
+}
+
+// Requires client.mutex.
+func (client *TCPClient) connectionExecutor() CallbackExecutor {
+	executor := client.executor
+	switch executor.(type) {
+	case nil:
+		executor = client.routines.executor()
+	case inlineExecutor:
+		executor = groupInlineExecutor{group: &client.routines}
+	}
+
+	if client.orderedAnswers {
+		return newSerialExecutor(executor)
+	}
+	return executor
+}
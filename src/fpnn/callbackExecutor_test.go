@@ -0,0 +1,116 @@
+package fpnn
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolCallbackExecutorBoundsWorkers(t *testing.T) {
+	executor := NewPoolCallbackExecutor(2, 8)
+
+	var running, maxRunning, finished int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		executor.Execute(func() {
+			defer wg.Done()
+
+			current := atomic.AddInt32(&running, 1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&finished, 1)
+		})
+	}
+	wg.Wait()
+
+	if maxRunning > 2 || finished != 20 {
+		t.Fatalf("max running: %d, finished: %d", maxRunning, finished)
+	}
+
+	executor.Close()
+
+	done := make(chan bool, 1)
+	executor.Execute(func() { done <- true })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("task executed after Close() is lost")
+	}
+}
+
+func TestSerialExecutorKeepsOrder(t *testing.T) {
+	serial := newSerialExecutor((&goroutineGroup{}).executor())
+
+	var mutex sync.Mutex
+	var order []int
+	var running int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 500; i++ {
+		idx := i
+		wg.Add(1)
+		serial.Execute(func() {
+			defer wg.Done()
+
+			if atomic.AddInt32(&running, 1) != 1 {
+				t.Errorf("tasks run concurrently")
+			}
+			mutex.Lock()
+			order = append(order, idx)
+			mutex.Unlock()
+			atomic.AddInt32(&running, -1)
+		})
+	}
+	wg.Wait()
+
+	for i, idx := range order {
+		if i != idx {
+			t.Fatalf("task %d runs at position %d", idx, i)
+		}
+	}
+}
+
+func TestClientWithPoolCallbackExecutor(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	executor := NewPoolCallbackExecutor(2, 16)
+	defer executor.Close()
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetCallbackExecutor(executor)
+	client.SetOrderedAnswerCallbacks(true)
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	var failed int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		err := client.SendQuestWithLambda(NewQuest("test"), func(answer *Answer, errorCode int) {
+			if errorCode != FPNN_EC_OK {
+				atomic.AddInt32(&failed, 1)
+			}
+			wg.Done()
+		})
+		if err != nil {
+			t.Fatalf("send quest failed, err: %v", err)
+		}
+	}
+	wg.Wait()
+
+	if failed != 0 {
+		t.Fatalf("%d quests failed", failed)
+	}
+
+	if _, err := client.SendQuest(NewQuest("test")); err != nil {
+		t.Fatalf("send sync quest failed, err: %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+package fpnn
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type CircuitBreakerState int
+
+const (
+	CircuitBreakerClosed CircuitBreakerState = iota
+	CircuitBreakerOpen
+	CircuitBreakerHalfOpen
+)
+
+func (state CircuitBreakerState) String() string {
+	switch state {
+	case CircuitBreakerClosed:
+		return "closed"
+	case CircuitBreakerOpen:
+		return "open"
+	case CircuitBreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(state))
+	}
+}
+
+/*
+CircuitBreakerPolicy decides when the circuit breaker of a TCPClient trips.
+
+	Window:					period for counting quests and failures. Default is 10 seconds.
+	MinQuests:				min quests in the window before the breaker may trip. Default is 20.
+	FailureRatio:			ratio of failed quests which trips the breaker. Default is 0.5.
+	TripOnTimeout:			count FPNN_EC_CORE_TIMEOUT as failure.
+	TripOnConnectionError:	count send errors and closed connections as failure.
+	TripErrorCodes:			other error codes counted as failure.
+	OpenDuration:			time to short-circuit quests before probing. Default is 5 seconds.
+	HalfOpenQuests:			probing quests allowed in half-open state. Default is 1.
+*/
+type CircuitBreakerPolicy struct {
+	Window                time.Duration
+	MinQuests             int
+	FailureRatio          float64
+	TripOnTimeout         bool
+	TripOnConnectionError bool
+	TripErrorCodes        []int
+	OpenDuration          time.Duration
+	HalfOpenQuests        int
+}
+
+type CircuitBreakerOpenError struct {
+	Endpoint   string
+	RetryAfter time.Duration
+}
+
+func (err *CircuitBreakerOpenError) Error() string {
+	return fmt.Sprintf("Circuit breaker of %s is open, retry after %v.", err.Endpoint, err.RetryAfter.Round(time.Millisecond))
+}
+
+type circuitBreakerStateChangedCallback func(endpoint string, from CircuitBreakerState, to CircuitBreakerState)
+
+func (policy *CircuitBreakerPolicy) normalize() *CircuitBreakerPolicy {
+	normalized := *policy
+	normalized.TripErrorCodes = append([]int(nil), policy.TripErrorCodes...)
+	if normalized.Window <= 0 {
+		normalized.Window = 10 * time.Second
+	}
+	if normalized.MinQuests <= 0 {
+		normalized.MinQuests = 20
+	}
+	if normalized.FailureRatio <= 0 || normalized.FailureRatio > 1 {
+		normalized.FailureRatio = 0.5
+	}
+	if normalized.OpenDuration <= 0 {
+		normalized.OpenDuration = 5 * time.Second
+	}
+	if normalized.HalfOpenQuests <= 0 {
+		normalized.HalfOpenQuests = 1
+	}
+	return &normalized
+}
+
+func (policy *CircuitBreakerPolicy) isFailure(errorCode int) bool {
+	switch errorCode {
+	case FPNN_EC_OK:
+		return false
+	case FPNN_EC_CORE_TIMEOUT:
+		if policy.TripOnTimeout {
+			return true
+		}
+	case FPNN_EC_CORE_CONNECTION_CLOSED, FPNN_EC_CORE_SEND_ERROR, FPNN_EC_CORE_INVALID_CONNECTION:
+		if policy.TripOnConnectionError {
+			return true
+		}
+	}
+
+	for _, code := range policy.TripErrorCodes {
+		if code == errorCode {
+			return true
+		}
+	}
+	return false
+}
+
+//-----------------[ circuitBreaker ]-----------------//
+
+type circuitBreaker struct {
+	mutex          sync.Mutex
+	policy         *CircuitBreakerPolicy
+	endpoint       string
+	state          CircuitBreakerState
+	windowStart    time.Time
+	quests         int
+	failures       int
+	openedTime     time.Time
+	probing        int
+	probeSucceeded int
+	generation     uint64
+	changes        []circuitBreakerStateChange
+	onStateChanged circuitBreakerStateChangedCallback
+}
+
+func newCircuitBreaker(endpoint string, policy *CircuitBreakerPolicy, onStateChanged circuitBreakerStateChangedCallback) *circuitBreaker {
+	return &circuitBreaker{
+		policy:         policy,
+		endpoint:       endpoint,
+		state:          CircuitBreakerClosed,
+		windowStart:    time.Now(),
+		onStateChanged: onStateChanged,
+	}
+}
+
+func (breaker *circuitBreaker) currentState() CircuitBreakerState {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	return breaker.state
+}
+
+type circuitBreakerStateChange struct {
+	from CircuitBreakerState
+	to   CircuitBreakerState
+}
+
+func (breaker *circuitBreaker) notify(changes []circuitBreakerStateChange) {
+	if breaker.onStateChanged == nil {
+		return
+	}
+
+	for _, change := range changes {
+		breaker.onStateChanged(breaker.endpoint, change.from, change.to)
+	}
+}
+
+/*
+The returned probe is non-zero if the quest takes a probe slot of the half-open state.
+Pass it to record() or release() when the quest is completed or dropped.
+*/
+func (breaker *circuitBreaker) allow() (probe uint64, err error) {
+	breaker.mutex.Lock()
+	probe, err = breaker.realAllow()
+	changes := breaker.changes
+	breaker.changes = nil
+	breaker.mutex.Unlock()
+
+	breaker.notify(changes)
+	return
+}
+
+func (breaker *circuitBreaker) realAllow() (uint64, error) {
+	switch breaker.state {
+	case CircuitBreakerOpen:
+		retryAfter := time.Until(breaker.openedTime.Add(breaker.policy.OpenDuration))
+		if retryAfter > 0 {
+			return 0, &CircuitBreakerOpenError{Endpoint: breaker.endpoint, RetryAfter: retryAfter}
+		}
+		breaker.transit(CircuitBreakerHalfOpen)
+		fallthrough
+
+	case CircuitBreakerHalfOpen:
+		if breaker.probing >= breaker.policy.HalfOpenQuests {
+			return 0, &CircuitBreakerOpenError{Endpoint: breaker.endpoint}
+		}
+		breaker.probing += 1
+		return breaker.generation, nil
+	}
+	return 0, nil
+}
+
+func (breaker *circuitBreaker) record(errorCode int, probe uint64) {
+	breaker.mutex.Lock()
+	breaker.realRecord(errorCode, probe)
+	changes := breaker.changes
+	breaker.changes = nil
+	breaker.mutex.Unlock()
+
+	breaker.notify(changes)
+}
+
+// Gives back the probe slot of a quest which is dropped or cancelled. It is neither a success nor a failure.
+func (breaker *circuitBreaker) release(probe uint64) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.realRelease(probe)
+}
+
+func (breaker *circuitBreaker) realRelease(probe uint64) {
+	if breaker.state == CircuitBreakerHalfOpen && probe == breaker.generation && breaker.probing > 0 {
+		breaker.probing -= 1
+	}
+}
+
+func (breaker *circuitBreaker) realRecord(errorCode int, probe uint64) {
+
+	if errorCode == FPNN_EC_SDK_QUEST_CANCELLED {
+		breaker.realRelease(probe)
+		return
+	}
+
+	failed := breaker.policy.isFailure(errorCode)
+
+	switch breaker.state {
+	case CircuitBreakerHalfOpen:
+		if failed {
+			breaker.transit(CircuitBreakerOpen)
+			return
+		}
+
+		//-- Quests sent before the half-open state are not probes.
+		if probe != breaker.generation {
+			return
+		}
+
+		breaker.probeSucceeded += 1
+		if breaker.probeSucceeded >= breaker.policy.HalfOpenQuests {
+			breaker.transit(CircuitBreakerClosed)
+		}
+
+	case CircuitBreakerClosed:
+		now := time.Now()
+		if now.Sub(breaker.windowStart) >= breaker.policy.Window {
+			breaker.windowStart = now
+			breaker.quests = 0
+			breaker.failures = 0
+		}
+
+		breaker.quests += 1
+		if failed {
+			breaker.failures += 1
+		}
+
+		if breaker.quests >= breaker.policy.MinQuests &&
+			float64(breaker.failures) >= breaker.policy.FailureRatio*float64(breaker.quests) {
+			breaker.transit(CircuitBreakerOpen)
+		}
+	}
+}
+
+func (breaker *circuitBreaker) transit(state CircuitBreakerState) {
+	breaker.changes = append(breaker.changes, circuitBreakerStateChange{from: breaker.state, to: state})
+	breaker.state = state
+	breaker.generation += 1
+
+	breaker.probing = 0
+	breaker.probeSucceeded = 0
+
+	switch state {
+	case CircuitBreakerOpen:
+		breaker.openedTime = time.Now()
+	case CircuitBreakerClosed:
+		breaker.windowStart = time.Now()
+		breaker.quests = 0
+		breaker.failures = 0
+	}
+}
+
+//-----------------[ TCPClient circuit breaker ]-----------------//
+
+/*
+Set nil policy to disable the circuit breaker.
+When the breaker is open, sending interfaces return *CircuitBreakerOpenError immediately.
+*/
+func (client *TCPClient) SetCircuitBreaker(policy *CircuitBreakerPolicy) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if policy == nil {
+		client.breaker = nil
+		return
+	}
+
+	client.breaker = newCircuitBreaker(client.endpoint, policy.normalize(), func(endpoint string, from CircuitBreakerState, to CircuitBreakerState) {
+		client.mutex.Lock()
+		callback := client.breakerCallback
+		client.mutex.Unlock()
+
+		if callback != nil {
+			callback(endpoint, from, to)
+		}
+	})
+}
+
+func (client *TCPClient) SetOnCircuitBreakerStateChangedCallback(callback circuitBreakerStateChangedCallback) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.breakerCallback = callback
+}
+
+func (client *TCPClient) CircuitBreakerState() CircuitBreakerState {
+	client.mutex.Lock()
+	breaker := client.breaker
+	client.mutex.Unlock()
+
+	if breaker == nil {
+		return CircuitBreakerClosed
+	}
+	return breaker.currentState()
+}
+
+func (client *TCPClient) getCircuitBreaker() *circuitBreaker {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.breaker
+}
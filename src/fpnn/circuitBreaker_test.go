@@ -0,0 +1,101 @@
+package fpnn
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var healthy int32
+	server := newTestServer(t, func(quest *Quest) *Answer {
+		if atomic.LoadInt32(&healthy) == 0 {
+			return NewErrorAnswer(quest, FPNN_EC_CORE_WORK_QUEUE_FULL, "busy")
+		}
+		return NewAnswer(quest)
+	})
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	defer client.Close()
+
+	changes := make(chan CircuitBreakerState, 10)
+	client.SetOnCircuitBreakerStateChangedCallback(func(endpoint string, from CircuitBreakerState, to CircuitBreakerState) {
+		changes <- to
+	})
+	client.SetCircuitBreaker(&CircuitBreakerPolicy{
+		MinQuests:      3,
+		TripErrorCodes: []int{FPNN_EC_CORE_WORK_QUEUE_FULL},
+		OpenDuration:   100 * time.Millisecond,
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.SendQuest(NewQuest("test")); err != nil {
+			t.Fatalf("send quest failed, err: %v", err)
+		}
+	}
+
+	if state := <-changes; state != CircuitBreakerOpen {
+		t.Fatalf("expect breaker open, got %v", state)
+	}
+
+	var openErr *CircuitBreakerOpenError
+	if _, err := client.SendQuest(NewQuest("test")); !errors.As(err, &openErr) {
+		t.Fatalf("expect short-circuit error, err: %v", err)
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(150 * time.Millisecond)
+
+	answer, err := client.SendQuest(NewQuest("test"))
+	if err != nil || answer.IsException() {
+		t.Fatalf("probing quest failed, answer: %v, err: %v", answer, err)
+	}
+	if state := <-changes; state != CircuitBreakerHalfOpen {
+		t.Fatalf("expect breaker half-open, got %v", state)
+	}
+	if state := <-changes; state != CircuitBreakerClosed {
+		t.Fatalf("expect breaker closed, got %v", state)
+	}
+}
+
+func TestCircuitBreakerProbeRelease(t *testing.T) {
+	breaker := newCircuitBreaker("test", (&CircuitBreakerPolicy{MinQuests: 1, TripErrorCodes: []int{FPNN_EC_CORE_WORK_QUEUE_FULL}, OpenDuration: time.Millisecond}).normalize(), nil)
+
+	stale, _ := breaker.allow()
+	breaker.record(FPNN_EC_CORE_WORK_QUEUE_FULL, stale)
+	time.Sleep(5 * time.Millisecond)
+
+	probe, err := breaker.allow()
+	if err != nil || breaker.currentState() != CircuitBreakerHalfOpen {
+		t.Fatalf("probe is not allowed, err: %v", err)
+	}
+	if _, err := breaker.allow(); err == nil {
+		t.Fatalf("second probe is allowed")
+	}
+
+	//-- Dropped probe, e.g. a hedge loser.
+	breaker.release(probe)
+	if probe, err = breaker.allow(); err != nil {
+		t.Fatalf("probe slot is not released, err: %v", err)
+	}
+
+	//-- Cancelled probe is not a success.
+	breaker.record(FPNN_EC_SDK_QUEST_CANCELLED, probe)
+	if state := breaker.currentState(); state != CircuitBreakerHalfOpen {
+		t.Fatalf("cancelled probe changes the state to %v", state)
+	}
+
+	//-- Quests sent before the half-open state are not probes.
+	breaker.record(FPNN_EC_OK, stale)
+	if state := breaker.currentState(); state != CircuitBreakerHalfOpen {
+		t.Fatalf("stale quest changes the state to %v", state)
+	}
+
+	probe, _ = breaker.allow()
+	breaker.record(FPNN_EC_OK, probe)
+	if state := breaker.currentState(); state != CircuitBreakerClosed {
+		t.Fatalf("expect breaker closed, got %v", state)
+	}
+}
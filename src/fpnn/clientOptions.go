@@ -0,0 +1,203 @@
+package fpnn
+
+import (
+	"time"
+)
+
+/*
+Options are frozen into the client when it is created, and are never changed later.
+The SetXxx() methods change the current settings of the client only, which start from the options.
+*/
+type ClientOption func(options *clientOptions)
+
+// The options of a client. Read without locking, as they are immutable after the client is created.
+type clientOptions struct {
+	questTimeout   time.Duration
+	connectTimeout time.Duration
+	chanBufferSize int
+	maxPayloadSize int
+	logger         Logger
+	leveledLogger  LeveledLogger
+	autoReconnect  bool
+	keepAlive      *KeepAliveParams
+	trySend        bool
+	writeBatch     *writeBatchParams
+	questProcessor QuestProcessor
+}
+
+// Taken from the client when a connection is created. 0 means the value of Config at use time.
+type connectionOptions struct {
+	questTimeout      time.Duration
+	netChanBufferSize int
+	maxPayloadSize    int
+}
+
+func (options *connectionOptions) getQuestTimeout() time.Duration {
+	if options.questTimeout > 0 {
+		return options.questTimeout
+	}
+	return Config.questTimeout
+}
+
+func (options *connectionOptions) getNetChanBufferSize() int {
+	if options.netChanBufferSize > 0 {
+		return options.netChanBufferSize
+	}
+	return Config.netChanBufferSize
+}
+
+func (options *connectionOptions) getMaxPayloadSize() int {
+	if options.maxPayloadSize > 0 {
+		return options.maxPayloadSize
+	}
+	return Config.maxPayloadSize
+}
+
+func WithQuestTimeout(timeout time.Duration) ClientOption {
+	return func(options *clientOptions) {
+		if timeout > 0 {
+			options.questTimeout = timeout
+		}
+	}
+}
+
+func WithConnectTimeout(timeout time.Duration) ClientOption {
+	return func(options *clientOptions) {
+		if timeout > 0 {
+			options.connectTimeout = timeout
+		}
+	}
+}
+
+// Size of the write queue of the connection, in frames.
+func WithNetChannelBufferSize(size int) ClientOption {
+	return func(options *clientOptions) {
+		if size > 0 {
+			options.chanBufferSize = size
+		}
+	}
+}
+
+// Received messages with larger payload close the connection.
+func WithMaxPayloadSize(size int) ClientOption {
+	return func(options *clientOptions) {
+		if size > 0 {
+			options.maxPayloadSize = size
+		}
+	}
+}
+
+// The logger of the client, used when no logger is set by SetLogger(). Config logger if not set.
+func WithLogger(logger Logger) ClientOption {
+	return func(options *clientOptions) {
+		if logger != nil {
+			options.logger = logger
+		}
+	}
+}
+
+func WithLeveledLogger(logger LeveledLogger) ClientOption {
+	return func(options *clientOptions) {
+		options.leveledLogger = logger
+	}
+}
+
+func WithAutoReconnect(autoReconnect bool) ClientOption {
+	return func(options *clientOptions) {
+		options.autoReconnect = autoReconnect
+	}
+}
+
+/*
+Enables keep alive. Params less than or equal to 0 take the default values:
+
+	interval:		Config ping interval, 10 seconds.
+	timeout:		quest timeout of the client.
+	maxPingRetryCount:	2.
+*/
+func WithKeepAlive(interval time.Duration, timeout time.Duration, maxPingRetryCount int) ClientOption {
+	return func(options *clientOptions) {
+		params := &KeepAliveParams{
+			pingInterval:      Config.pingInterval,
+			pingTimeout:       timeout,
+			maxPingRetryCount: Config.maxPingRetryCount,
+		}
+		if interval > 0 {
+			params.pingInterval = interval
+		}
+		if timeout < 0 {
+			params.pingTimeout = 0
+		}
+		if maxPingRetryCount > 0 {
+			params.maxPingRetryCount = maxPingRetryCount
+		}
+		options.keepAlive = params
+	}
+}
+
+// Same as SetTrySendMode().
+func WithTrySendMode(trySend bool) ClientOption {
+	return func(options *clientOptions) {
+		options.trySend = trySend
+	}
+}
+
+// Same as SetWriteBatch().
+func WithWriteBatch(maxFrames int, maxBytes int, flushLatency time.Duration) ClientOption {
+	return func(options *clientOptions) {
+		params := defaultWriteBatchParams
+		if maxFrames > 0 {
+			params.maxFrames = maxFrames
+		}
+		if maxBytes > 0 {
+			params.maxBytes = maxBytes
+		}
+		if flushLatency > 0 {
+			params.flushLatency = flushLatency
+		}
+		options.writeBatch = &params
+	}
+}
+
+func WithQuestProcessor(questProcessor QuestProcessor) ClientOption {
+	return func(options *clientOptions) {
+		options.questProcessor = questProcessor
+	}
+}
+
+/*
+Creates a client with its own options, which are independent of the other clients.
+The quest timeout, the connect timeout and the logger not set take the values of Config at that time.
+The buffer size and the payload limit not set follow Config, same as NewTCPClient().
+*/
+func NewTCPClientWithOptions(endpoint string, opts ...ClientOption) *TCPClient {
+
+	options := clientOptions{
+		questTimeout:   Config.questTimeout,
+		connectTimeout: Config.connectTimeout,
+		autoReconnect:  true,
+	}
+	if Config.logger != nil {
+		options.logger = Config.logger
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+
+	client := &TCPClient{options: options}
+	client.endpoint = endpoint
+	client.autoReconnect = options.autoReconnect
+	client.timeout = options.questTimeout
+	client.connectTimeout = options.connectTimeout
+	client.leveledLogger = options.leveledLogger
+	client.keepAliveParams = options.keepAlive
+	client.trySend = options.trySend
+	client.writeBatch = options.writeBatch
+	client.questProcessor = options.questProcessor
+	client.offlineQueue.routines = &client.routines
+	client.stats.clientId = nextClientId()
+	return client
+}
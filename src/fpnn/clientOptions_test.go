@@ -0,0 +1,150 @@
+package fpnn
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientOptionsAreIndependent(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	events := make(eventRecorder, 16)
+	small := NewTCPClientWithOptions(server.endpoint(),
+		WithLogger(testLogger),
+		WithAutoReconnect(false),
+		WithMaxPayloadSize(64),
+		WithNetChannelBufferSize(2),
+		WithQuestTimeout(3*time.Second),
+		WithKeepAlive(time.Second, 0, 3))
+	small.SetConnectionEventListener(events)
+	defer small.Close()
+
+	large := NewTCPClientWithOptions(server.endpoint(), WithLogger(testLogger), WithNetChannelBufferSize(16))
+	defer large.Close()
+
+	if !small.Connect() || !large.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	smallConn := small.conn
+	if cap(smallConn.writeChan) != 2 || cap(large.conn.writeChan) != 16 {
+		t.Fatalf("unexpected write queue sizes: %d, %d", cap(smallConn.writeChan), cap(large.conn.writeChan))
+	}
+	if smallConn.keepAliveInfo == nil || smallConn.keepAliveInfo.pingTimeout != 3*time.Second || smallConn.keepAliveInfo.maxPingRetryCount != 3 {
+		t.Fatalf("unexpected keep alive params: %+v", smallConn.keepAliveInfo)
+	}
+	if large.conn.keepAliveInfo != nil {
+		t.Fatalf("keep alive is enabled without the option")
+	}
+
+	quest := NewQuest("echo")
+	quest.Param("data", strings.Repeat("x", 128))
+
+	if answer, err := large.SendQuest(quest); err != nil || answer.IsException() {
+		t.Fatalf("large client failed, err: %v", err)
+	}
+
+	events.expect(t, ConnectionEventDialing)
+	events.expect(t, ConnectionEventConnected)
+
+	small.SendQuestWithLambda(quest, func(answer *Answer, errorCode int) {})
+	if closed := events.expect(t, ConnectionEventClosed); closed.Reason != CloseReasonDecodeError {
+		t.Fatalf("unexpected closed event: %+v", closed)
+	}
+	if !large.IsConnected() {
+		t.Fatalf("large client is closed")
+	}
+}
+
+func TestSettersWithInFlightQuests(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	client := NewTCPClientWithOptions(server.endpoint(), WithLogger(testLogger))
+	defer client.Close()
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			client.SetQuestTimeOut(time.Duration(i+1) * time.Second)
+			client.SetKeepAliveIntervalSecond(time.Duration(i+1) * time.Second)
+			client.SetAutoReconnect(i%2 == 0)
+			client.SetLogger(testLogger)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if _, err := client.SendQuest(NewQuest("echo")); err != nil {
+				t.Errorf("send quest failed, err: %v", err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestClientFollowsConfigBufferSize(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	defer client.Close()
+
+	bufferSize := Config.netChanBufferSize
+	Config.SetNetChannelBufferSize(7)
+	defer Config.SetNetChannelBufferSize(bufferSize)
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+	if size := cap(client.conn.writeChan); size != 7 {
+		t.Fatalf("write queue size does not follow Config: %d", size)
+	}
+}
+
+type chanWriter chan string
+
+func (writer chanWriter) Write(data []byte) (int, error) {
+	writer <- string(data)
+	return len(data), nil
+}
+
+func TestClientOptionsAreFrozen(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	logs := make(chanWriter, 16)
+	client := NewTCPClientWithOptions(server.endpoint(),
+		WithLogger(log.New(logs, "", 0)),
+		WithQuestTimeout(3*time.Second),
+		WithQuestProcessor(&blockingProcessor{}))
+	client.SetQuestMiddlewares(NewLoggingMiddleware(nil))
+	defer client.Close()
+
+	client.SetQuestTimeOut(time.Second)
+	if client.options.questTimeout != 3*time.Second || client.defaultQuestTimeout() != time.Second {
+		t.Fatalf("options are changed by the setter: %v, %v", client.options.questTimeout, client.defaultQuestTimeout())
+	}
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+	server.pushQuest(t, NewOneWayQuest("push"))
+
+	select {
+	case line := <-logs:
+		if !strings.Contains(line, "Quest processed.") || !strings.Contains(line, "method=push") {
+			t.Fatalf("unexpected log: %s", line)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("quest is not logged by the logger of the client")
+	}
+}
@@ -1,21 +1,34 @@
 package fpnn
 
 import (
-	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"net"
-	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
-	"unsafe"
 )
 
+var ErrWriteQueueFull = errors.New("Write queue is full.")
+
+var errInvalidMessage = errors.New("Invalid message.")
+
+// Precision of the quest timeouts and the keep alive checks.
+const timeoutCheckInterval = 100 * time.Millisecond
+
+type writeFrame struct {
+	data    []byte
+	handle  *QuestHandle
+	flushed chan struct{}
+}
+
 type rawData struct {
 	header []byte
 	body   []byte
+	buffer *[]byte
 }
 
 func newRawData() *rawData {
@@ -25,13 +38,18 @@ func newRawData() *rawData {
 }
 
 type connCallback struct {
-	timeout      int64
+	deadline     time.Time
 	callback     AnswerCallback
 	callbackFunc func(answer *Answer, errorCode int)
+	breaker      *circuitBreaker
+	breakerProbe uint64
+	method       string
+	sentTime     time.Time
 }
 
 type encryptionInfo struct {
 	aesKeyBits   int
+	curveName    string
 	secret       []byte
 	eccPublicKey []byte
 }
@@ -53,17 +71,20 @@ func (info *KeepAliveInfos) config(params *KeepAliveParams) {
 	info.lastPingSendMs = 0
 }
 
+// Updated by the read loop, and checked by the keep alive goroutines.
 func (info *KeepAliveInfos) updateReceivedMs() {
-	info.lastReceivedMs = time.Now().UnixNano() / 1e6
+	atomic.StoreInt64(&info.lastReceivedMs, time.Now().UnixNano()/1e6)
 }
 
 func (info *KeepAliveInfos) updatePingSentMs() {
-	info.lastPingSendMs = time.Now().UnixNano() / 1e6
+	atomic.StoreInt64(&info.lastPingSendMs, time.Now().UnixNano()/1e6)
 }
 
 func (info *KeepAliveInfos) isRequireSendPing() time.Duration {
 	now := time.Now().UnixNano() / 1e6
-	if (now >= info.lastReceivedMs+(int64)(info.pingInterval/time.Millisecond)) && (now >= info.lastPingSendMs+(int64)(info.pingTimeout/time.Millisecond)) {
+	lastReceivedMs := atomic.LoadInt64(&info.lastReceivedMs)
+	lastPingSendMs := atomic.LoadInt64(&info.lastPingSendMs)
+	if (now >= lastReceivedMs+(int64)(info.pingInterval/time.Millisecond)) && (now >= lastPingSendMs+(int64)(info.pingTimeout/time.Millisecond)) {
 		return info.pingTimeout
 	} else {
 		return 0
@@ -72,17 +93,18 @@ func (info *KeepAliveInfos) isRequireSendPing() time.Duration {
 
 func (info *KeepAliveInfos) isLost() bool {
 	now := time.Now().UnixNano() / 1e6
-	return now > (info.lastReceivedMs + (int64)(info.unreceivedThreshold))
+	return now > (atomic.LoadInt64(&info.lastReceivedMs) + (int64)(info.unreceivedThreshold))
 }
 
 ////////////////////////////////KeepAliveCallback/////////////////////////////
 
 type KeepAliveCallback struct {
 	connection *tcpConnection
+	sentTime   time.Time
 }
 
 func (callback *KeepAliveCallback) OnAnswer(answer *Answer) {
-
+	callback.connection.stats.setKeepAliveRTT(time.Since(callback.sentTime))
 }
 
 func (callback *KeepAliveCallback) OnException(answer *Answer, errorCode int) {
@@ -90,44 +112,72 @@ func (callback *KeepAliveCallback) OnException(answer *Answer, errorCode int) {
 	if answer != nil {
 		errInfo, _ = answer.GetString("ex")
 	}
-	callback.connection.logger.Printf("Keep alive ping for %s failed, local addr: %s. errorCode: %d, infos: %s", callback.connection.conn.RemoteAddr(), callback.connection.conn.LocalAddr(), errorCode, errInfo)
+	callback.connection.logWarn("Keep alive ping failed.", "localAddr", callback.connection.conn.LocalAddr(), "errorCode", errorCode, "ex", errInfo)
 }
 
 type tcpConnection struct {
-	mutex          sync.Mutex
-	answerMap      map[uint32]*connCallback
-	conn           net.Conn
-	seqNum         uint32
-	closeSignChan  chan bool
-	writeChan      chan []byte
-	ticker         *time.Ticker
-	connected      bool
-	logger         Logger
-	onConnected    tcpClientConnectedCallback
-	onClosed       tcpClientCloseCallback
-	questProcessor QuestProcessor
-	activeClosed   bool
-	encryptInfo    *encryptionInfo
-	keepAliveInfo  *KeepAliveInfos
-}
-
-func newTCPConnection(logger Logger, onConnected tcpClientConnectedCallback, onClosed tcpClientCloseCallback,
-	questProcessor QuestProcessor, keepAliveParams *KeepAliveParams) *tcpConnection {
+	mutex           sync.Mutex
+	options         *connectionOptions
+	answerMap       map[uint32]*connCallback
+	conn            net.Conn
+	seqNum          uint32
+	closedChan      chan struct{}
+	writeChan       chan writeFrame
+	ticker          *time.Ticker
+	connected       bool
+	logger          LeveledLogger
+	onConnected     tcpClientConnectedCallback
+	onClosed        tcpClientCloseCallback
+	onConnectedInfo func(info *ConnectionInfo, connected bool)
+	onClosedInfo    func(info *ConnectionInfo)
+	questProcessor  QuestProcessor
+	activeClosed    bool
+	encryptInfo     *encryptionInfo
+	keepAliveInfo   *KeepAliveInfos
+	trySend         bool
+	writeBatch      writeBatchParams
+	executor        CallbackExecutor
+	questPool       *questWorkerPool
+	middlewares     []QuestMiddleware
+	stats           *clientStats
+	connectedTime   time.Time
+	tracing         *tracingConfig
+	endpoint        string
+	connId          uint64
+	info            *ConnectionInfo
+	events          func(event *ConnectionEvent)
+	closeReason     CloseReason
+	closeErr        error
+	draining        bool
+	answersDrained  chan struct{}
+	routines        *goroutineGroup
+	dialCtx         context.Context
+	dialCancel      context.CancelFunc
+}
+
+func newTCPConnection(logger LeveledLogger, onConnected tcpClientConnectedCallback, onClosed tcpClientCloseCallback,
+	questProcessor QuestProcessor, keepAliveParams *KeepAliveParams, options *connectionOptions) *tcpConnection {
+
+	if options == nil {
+		options = &connectionOptions{}
+	}
 
 	conn := new(tcpConnection)
+	conn.options = options
 	conn.answerMap = make(map[uint32]*connCallback)
-	conn.closeSignChan = make(chan bool)
-	conn.writeChan = make(chan []byte, Config.netChanBufferSize)
+	conn.closedChan = make(chan struct{})
+	conn.writeChan = make(chan writeFrame, options.getNetChanBufferSize())
+	conn.writeBatch = defaultWriteBatchParams
+	conn.routines = &goroutineGroup{}
+	conn.executor = conn.routines.executor()
 
 	now := time.Now()
 	conn.seqNum = uint32(now.UnixNano() & 0xFFF)
+	conn.connId = nextConnId()
+	conn.dialCtx, conn.dialCancel = context.WithCancel(context.Background())
 
 	conn.connected = false
-	if logger != nil {
-		conn.logger = logger
-	} else {
-		conn.logger = Config.logger
-	}
+	conn.logger = logger
 
 	conn.onConnected = onConnected
 	conn.onClosed = onClosed
@@ -135,15 +185,12 @@ func newTCPConnection(logger Logger, onConnected tcpClientConnectedCallback, onC
 	conn.questProcessor = questProcessor
 	conn.activeClosed = false
 	if keepAliveParams != nil {
-		info := new(KeepAliveInfos)
-		conn.keepAliveInfo = info
-		if keepAliveParams.pingTimeout == 0 {
-			keepAliveParams.pingTimeout = Config.questTimeout
-			conn.keepAliveInfo.config(keepAliveParams)
-			keepAliveParams.pingTimeout = 0
-		} else {
-			conn.keepAliveInfo.config(keepAliveParams)
+		params := *keepAliveParams
+		if params.pingTimeout == 0 {
+			params.pingTimeout = options.getQuestTimeout()
 		}
+		conn.keepAliveInfo = new(KeepAliveInfos)
+		conn.keepAliveInfo.config(&params)
 	}
 
 	return conn
@@ -156,10 +203,6 @@ func (conn *tcpConnection) isConnected() bool {
 	return conn.connected
 }
 
-func cleanTCPConnection(conn *tcpConnection) {
-	go conn.close()
-}
-
 func (conn *tcpConnection) isRequireKeepAlive() (bool, time.Duration) {
 	isLost := false
 	if conn.keepAliveInfo == nil {
@@ -187,104 +230,124 @@ func (conn *tcpConnection) enableEncryptor(aesBits int, serverKey *eccPublicKeyI
 
 	info, err := makeEcdhInfo(serverKey)
 	if err != nil {
-		conn.logger.Printf("[ERROR] Make ecdh info error, err: %v", err)
+		conn.logError("Make ecdh info failed.", "err", err)
 		return false
 	}
 
 	conn.encryptInfo = &encryptionInfo{}
 	conn.encryptInfo.aesKeyBits = aesBits
+	conn.encryptInfo.curveName = serverKey.curveName
 	conn.encryptInfo.eccPublicKey = info.publicKey
 	conn.encryptInfo.secret = info.secret
 
 	return true
 }
 
-func (conn *tcpConnection) realConnect(endpoint string, timeout time.Duration) (ok bool) {
-	var err error
+func (conn *tcpConnection) realConnect(endpoint string, timeout time.Duration) error {
+	if conn.isConnected() {
+		return nil
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	netConn, err := dialer.DialContext(conn.dialCtx, "tcp", endpoint)
+	if err != nil {
+		conn.logError("Connect failed.", "err", err)
+		return err
+	}
 
 	conn.mutex.Lock()
 	defer conn.mutex.Unlock()
 
-	if conn.connected {
-		return true
+	//-- close() may be called while dialing. Then nobody would close the connection.
+	if err := conn.dialCtx.Err(); err != nil {
+		netConn.Close()
+		return err
 	}
 
-	conn.conn, err = net.DialTimeout("tcp", endpoint, timeout)
-	if err != nil {
-		conn.connected = false
-		conn.logger.Printf("[ERROR] Connect to %s failed, err: %v", endpoint, err)
-		return false
-	}
-	conn.ticker = time.NewTicker(1 * time.Second)
+	conn.conn = netConn
+	conn.ticker = time.NewTicker(timeoutCheckInterval)
 
-	go conn.readLoop()
-	go conn.workLoop()
+	if !conn.routines.startLoops(conn.readLoop, conn.workLoop) {
+		netConn.Close()
+		return ErrClientClosed
+	}
 
 	conn.connected = true
-
-	runtime.SetFinalizer(conn, cleanTCPConnection)
-	return true
+	conn.connectedTime = time.Now()
+	conn.info = conn.buildInfo()
+	return nil
 }
 
 func (conn *tcpConnection) connect(endpoint string, timeout time.Duration) (ok bool) {
-	ok = conn.realConnect(endpoint, timeout)
+	conn.endpoint = endpoint
+	conn.emitEvent(&ConnectionEvent{Type: ConnectionEventDialing})
+
+	start := time.Now()
+	err := conn.realConnect(endpoint, timeout)
+	ok = err == nil
+	conn.stats.handshake("connect", ok, time.Since(start))
+	if ok {
+		conn.stats.connected()
+		conn.emitEvent(&ConnectionEvent{Type: ConnectionEventConnected})
+	} else {
+		conn.emitEvent(&ConnectionEvent{Type: ConnectionEventConnectFailed, Err: err})
+	}
+
 	if conn.onConnected != nil {
-		if ok {
-			go conn.onConnected(uint64(uintptr(unsafe.Pointer(conn))), endpoint, ok)
-		} else {
-			go conn.onConnected(0, endpoint, ok)
+		connId := conn.connId
+		if !ok {
+			connId = 0
 		}
+		conn.routines.executor().Execute(func() {
+			conn.onConnected(connId, endpoint, ok)
+		})
+	}
+	if conn.onConnectedInfo != nil {
+		info := conn.connectionInfo()
+		conn.routines.executor().Execute(func() {
+			conn.onConnectedInfo(info, ok)
+		})
 	}
 	return
 }
 
-func (conn *tcpConnection) readRawData(decoder *encryptor) *rawData {
-	buffer := newRawData()
+// The header of buffer is reused, and the body is taken from the pool. Call buffer.release() after decoding.
+func readRawData(reader io.Reader, buffer *rawData, decoder *encryptor, maxPayloadSize int) error {
 
-	if _, err := io.ReadFull(conn.conn, buffer.header); err != nil {
-		if err == io.EOF {
-		}
-		return nil
+	if _, err := io.ReadFull(reader, buffer.header); err != nil {
+		return err
 	}
 
 	if decoder != nil {
-		decHeader := decoder.decrypt(buffer.header)
-		buffer.header = decHeader
+		decoder.decryptInPlace(buffer.header)
 	}
 
-	var payloadSize uint32
-	headReader := bytes.NewReader(buffer.header[8:])
-	binary.Read(headReader, binary.LittleEndian, &payloadSize)
-
-	if payloadSize > uint32(Config.maxPayloadSize) {
-		conn.logger.Printf("[ERROR] Read huge payload, size: %d", payloadSize)
-		return nil
+	payloadSize := binary.LittleEndian.Uint32(buffer.header[8:])
+	if payloadSize > uint32(maxPayloadSize) {
+		return fmt.Errorf("%w Huge payload, size: %d.", errInvalidMessage, payloadSize)
 	}
 
 	switch buffer.header[6] {
 	case MessageTypeOneWay:
-		buffer.body = make([]byte, payloadSize+uint32(buffer.header[7]))
+		buffer.allocBody(int(payloadSize + uint32(buffer.header[7])))
 	case MessageTypeTwoWay:
-		buffer.body = make([]byte, payloadSize+4+uint32(buffer.header[7]))
+		buffer.allocBody(int(payloadSize + 4 + uint32(buffer.header[7])))
 	case MessageTypeAnswer:
-		buffer.body = make([]byte, payloadSize+4)
+		buffer.allocBody(int(payloadSize + 4))
 	default:
-		conn.logger.Printf("[ERROR] Receive invalid FPNN MType: %d", buffer.header[6])
-		return nil
+		return fmt.Errorf("%w Invalid FPNN MType: %d.", errInvalidMessage, buffer.header[6])
 	}
 
-	if _, err := io.ReadFull(conn.conn, buffer.body); err != nil {
-		if err == io.EOF {
-		}
-		return nil
+	if _, err := io.ReadFull(reader, buffer.body); err != nil {
+		buffer.release()
+		return err
 	}
 
 	if decoder != nil {
-		decBody := decoder.decrypt(buffer.body)
-		buffer.body = decBody
+		decoder.decryptInPlace(buffer.body)
 	}
 
-	return buffer
+	return nil
 }
 
 func (conn *tcpConnection) processRawData(data *rawData) bool {
@@ -294,16 +357,17 @@ func (conn *tcpConnection) processRawData(data *rawData) bool {
 
 		quest, err := NewQuestWithRawData(data)
 		if err != nil {
-			conn.logger.Printf("[ERROR] Decode quest failed, err: %v", err)
+			conn.logError("Decode quest failed.", "err", err)
 			return false
 		}
 
-		conn.dealQuest(quest)
+		quest.conn = conn
+		conn.dispatchQuest(quest)
 
 	case MessageTypeAnswer:
 		answer, err := NewAnswerWithRawData(data)
 		if err != nil {
-			conn.logger.Printf("[ERROR] Decode answer failed, err: %v", err)
+			conn.logError("Decode answer failed.", "err", err)
 			return false
 		}
 
@@ -311,12 +375,17 @@ func (conn *tcpConnection) processRawData(data *rawData) bool {
 		callback, ok := conn.answerMap[answer.seqNum]
 		if ok {
 			delete(conn.answerMap, answer.seqNum)
+			conn.notifyAnswersDrained()
+			executor := conn.executor
 			conn.mutex.Unlock()
 
-			go callAnswerCallback(answer, callback)
+			code, _ := answer.GetInt("code")
+			conn.stats.questCompleted(callback, code)
+			executeAnswerCallback(executor, answer, callback)
 		} else {
 			conn.mutex.Unlock()
-			conn.logger.Printf("[ERROR] Received invalid answer, seqNum: %d", answer.seqNum)
+			//-- Late answers of timed out, cancelled and dropped quests.
+			conn.logDebug("Received invalid answer.", "seqNum", answer.seqNum)
 		}
 	}
 	conn.updateReceivedMs()
@@ -324,8 +393,19 @@ func (conn *tcpConnection) processRawData(data *rawData) bool {
 	return true
 }
 
+func executeAnswerCallback(executor CallbackExecutor, answer *Answer, cb *connCallback) {
+	executor.Execute(func() {
+		callAnswerCallback(answer, cb)
+	})
+}
+
 func callAnswerCallback(answer *Answer, cb *connCallback) {
 
+	if cb.breaker != nil {
+		code, _ := answer.GetInt("code")
+		cb.breaker.record(code, cb.breakerProbe)
+	}
+
 	if cb.callback != nil {
 
 		if !answer.IsException() {
@@ -348,25 +428,26 @@ func (conn *tcpConnection) dealQuest(quest *Quest) {
 
 	defer func() {
 		if r := recover(); r != nil {
-			conn.logger.Printf("[ERROR] Process quest panic. Method: %s, panic: %v.", quest.method, r)
+			conn.logError("Process quest panic.", "method", quest.method, "seqNum", quest.seqNum, "panic", r)
 		}
 	}()
 
 	if conn.questProcessor != nil {
-		conn.realDealQuest(quest)
+		conn.routines.call(func() {
+			conn.realDealQuest(quest)
+		})
 	} else {
 		if quest.isTwoWay {
 
 			answer := NewErrorAnswer(quest, FPNN_EC_CORE_UNKNOWN_METHOD, "Client quest processor is unconfiged.")
 			if err := conn.sendAnswer(answer); err == nil {
-				conn.logger.Printf("[ERROR] Received twoway quest, but quest processor is nil. Method: %s.", quest.method)
+				conn.logError("Received twoway quest, but quest processor is nil.", "method", quest.method, "seqNum", quest.seqNum)
 			} else {
-				conn.logger.Printf("[ERROR] Received twoway quest, but quest processor is nil. Method: %s. Send default answer error, err: %v",
-					quest.method, err)
+				conn.logError("Received twoway quest, but quest processor is nil. Send default answer failed.", "method", quest.method, "seqNum", quest.seqNum, "err", err)
 			}
 
 		} else {
-			conn.logger.Printf("[ERROR] Received oneway quest, but quest processor is nil. Method: %s.", quest.method)
+			conn.logError("Received oneway quest, but quest processor is nil.", "method", quest.method)
 		}
 	}
 }
@@ -379,32 +460,40 @@ func (conn *tcpConnection) realDealQuest(quest *Quest) {
 
 			answer := NewErrorAnswer(quest, FPNN_EC_CORE_UNKNOWN_METHOD, "Method function is unconfiged.")
 			if err := conn.sendAnswer(answer); err == nil {
-				conn.logger.Printf("[ERROR] Received twoway quest, but method function is unconfiged. Method: %s.", quest.method)
+				conn.logError("Received twoway quest, but method function is unconfiged.", "method", quest.method, "seqNum", quest.seqNum)
 			} else {
-				conn.logger.Printf("[ERROR] Received twoway quest, but method function is unconfiged. Method: %s. Send default answer error, err: %v",
-					quest.method, err)
+				conn.logError("Received twoway quest, but method function is unconfiged. Send default answer failed.", "method", quest.method, "seqNum", quest.seqNum, "err", err)
 			}
 
 		} else {
-			conn.logger.Printf("[ERROR] Received oneway quest, but method function is unconfiged. Method: %s.", quest.method)
+			conn.logError("Received oneway quest, but method function is unconfiged.", "method", quest.method)
 		}
 
 		return
 	}
 
-	answer, err := processFunc(quest)
+	answer, err := conn.wrapQuestHandler(processFunc)(quest)
 	if err != nil {
-		conn.logger.Printf("[ERROR] Process quest error. Method: %s, err: %v", quest.method, err)
+		conn.logError("Process quest failed.", "method", quest.method, "seqNum", quest.seqNum, "err", err)
+	}
+
+	if quest.isDeferred() {
+		if answer != nil {
+			if err := quest.responder.SendAnswer(answer); err != nil {
+				conn.logError("Send quest answer failed.", "method", quest.method, "seqNum", quest.seqNum, "err", err)
+			}
+		}
+		return
 	}
 
 	if answer != nil {
 
 		if quest.isTwoWay {
 			if err := conn.sendAnswer(answer); err != nil {
-				conn.logger.Printf("[ERROR] Send quest answer error. Method: %s, err: %v", quest.method, err)
+				conn.logError("Send quest answer failed.", "method", quest.method, "seqNum", quest.seqNum, "err", err)
 			}
 		} else {
-			conn.logger.Printf("[ERROR] Return answer for oneway quest. Method: %s, answer: %v", quest.method, answer)
+			conn.logError("Return answer for oneway quest.", "method", quest.method, "answer", answer.data)
 		}
 
 	} else {
@@ -419,8 +508,7 @@ func (conn *tcpConnection) realDealQuest(quest *Quest) {
 			answer = NewErrorAnswer(quest, FPNN_EC_CORE_UNKNOWN_ERROR, ex)
 
 			if sendErr := conn.sendAnswer(answer); sendErr != nil {
-				conn.logger.Printf("[ERROR] Send quest error answer error. Method: %s, send error: %v, quest error: %v",
-					quest.method, sendErr, err)
+				conn.logError("Send quest error answer failed.", "method", quest.method, "seqNum", quest.seqNum, "err", sendErr, "questErr", err)
 			}
 		}
 	}
@@ -428,21 +516,31 @@ func (conn *tcpConnection) realDealQuest(quest *Quest) {
 
 func (conn *tcpConnection) readLoop() {
 
-	defer conn.close()
-
 	var decoder *encryptor
 	if conn.encryptInfo != nil {
 		decoder = newEncryptor(conn.encryptInfo.secret, conn.encryptInfo.aesKeyBits)
 	}
 
+	data := newRawData()
 	for {
-		data := conn.readRawData(decoder)
-		if data == nil {
+		if err := readRawData(conn.conn, data, decoder, conn.options.getMaxPayloadSize()); err != nil {
+			switch {
+			case errors.Is(err, errInvalidMessage):
+				conn.logError("Read message failed.", "err", err)
+				conn.closeWithReason(CloseReasonDecodeError, err)
+			case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+				conn.closeWithReason(CloseReasonPeerEOF, err)
+			default:
+				conn.closeWithReason(CloseReasonReadError, err)
+			}
 			return
 		}
+		conn.stats.recordReceived(len(data.header) + len(data.body))
 
 		ok := conn.processRawData(data)
+		data.release()
 		if !ok {
+			conn.closeWithReason(CloseReasonDecodeError, errInvalidMessage)
 			return
 		}
 	}
@@ -452,33 +550,43 @@ func (conn *tcpConnection) workLoop() {
 
 	encoder, err := conn.prepareEncryptedConnection()
 	if err != nil {
-		conn.logger.Printf("[ERROR] Prepare ecnryption handshake failed, err: %v", err)
-		close(conn.writeChan)
-		conn.close()
+		conn.logError("Prepare encryption handshake failed.", "err", err)
+		conn.emitEvent(&ConnectionEvent{Type: ConnectionEventHandshakeFailed, Err: err})
+		conn.closeWithReason(CloseReasonHandshakeFailed, err)
 		return
 	}
 
+	batch := &writeBatch{}
+
 	for {
 		select {
-		case binData := <-conn.writeChan:
+		case frame := <-conn.writeChan:
 
-			if encoder != nil {
-				encBinary := encoder.encrypt(binData)
-				binData = encBinary
+			batch.append(frame)
+			conn.collectWriteBatch(batch)
+
+			var err error
+			if len(batch.frames) > 0 {
+				err = conn.flushWriteBatch(batch, encoder)
 			}
 
-			if _, err := conn.conn.Write(binData); err != nil {
-				conn.logger.Printf("[ERROR] Write data to connection failed, err: %v", err)
-				go conn.close()
+			if err != nil {
+				conn.logError("Write data to connection failed.", "err", err)
+				conn.routines.start(func() {
+					conn.closeWithReason(CloseReasonWriteError, err)
+				})
+			} else {
+				batch.releaseBarriers()
 			}
+			batch.reset()
 
 		case <-conn.ticker.C:
-			go conn.cleanTimeoutedCallback()
+			conn.routines.start(conn.cleanTimeoutedCallback)
 			if conn.keepAliveInfo != nil {
-				go conn.checkSendPing()
+				conn.routines.start(conn.checkSendPing)
 			}
 
-		case <-conn.closeSignChan:
+		case <-conn.closedChan:
 			return
 		}
 	}
@@ -495,6 +603,7 @@ func (conn *tcpConnection) prepareEncryptedConnection() (*encryptor, error) {
 		if _, err := conn.conn.Write(binData); err != nil {
 			return nil, err
 		}
+		conn.stats.recordSent(len(binData), 1)
 
 		encoder := newEncryptor(conn.encryptInfo.secret, conn.encryptInfo.aesKeyBits)
 		return encoder, nil
@@ -505,17 +614,20 @@ func (conn *tcpConnection) prepareEncryptedConnection() (*encryptor, error) {
 
 func (conn *tcpConnection) checkSendPing() {
 	if isLost, timeout := conn.isRequireKeepAlive(); isLost {
-		conn.close()
-	} else if timeout > 0 {
+		conn.logWarn("Keep alive is lost.")
+		conn.emitEvent(&ConnectionEvent{Type: ConnectionEventKeepAliveLost})
+		conn.closeWithReason(CloseReasonKeepAliveTimeout, nil)
+	} else if timeout > 0 && !conn.isDraining() {
 		cb := &connCallback{}
-		cb.timeout = time.Now().Unix() + int64(timeout/time.Second)
+		cb.deadline = time.Now().Add(timeout)
 		callback := &KeepAliveCallback{}
 		callback.connection = conn
+		callback.sentTime = time.Now()
 		cb.callback = callback
 		quest := NewQuest("*ping")
 		err := conn.sendQuest(quest, cb)
 		if err != nil {
-			conn.logger.Printf("send keep alive ping return failed, err: %v", err)
+			conn.logWarn("Send keep alive ping failed.", "err", err)
 		}
 		conn.updateKeepAliveMs()
 	}
@@ -524,13 +636,14 @@ func (conn *tcpConnection) checkSendPing() {
 func (conn *tcpConnection) cleanTimeoutedCallback() {
 
 	now := time.Now()
-	curr := now.Unix()
 	timeoutedMap := make(map[uint32]*connCallback)
+	var executor CallbackExecutor
 	{
 		conn.mutex.Lock()
+		executor = conn.executor
 
 		for seqNum, callback := range conn.answerMap {
-			if callback.timeout <= curr {
+			if !callback.deadline.After(now) {
 				timeoutedMap[seqNum] = callback
 			}
 		}
@@ -538,6 +651,7 @@ func (conn *tcpConnection) cleanTimeoutedCallback() {
 		for seqNum, _ := range timeoutedMap {
 			delete(conn.answerMap, seqNum)
 		}
+		conn.notifyAnswersDrained()
 
 		conn.mutex.Unlock()
 	}
@@ -545,18 +659,23 @@ func (conn *tcpConnection) cleanTimeoutedCallback() {
 	for seqNum, callback := range timeoutedMap {
 
 		answer := newErrorAnswerWitSeqNum(seqNum, FPNN_EC_CORE_TIMEOUT, "Quest is timeout.")
-		go callAnswerCallback(answer, callback)
+		conn.stats.questCompleted(callback, FPNN_EC_CORE_TIMEOUT)
+		executeAnswerCallback(executor, answer, callback)
 	}
 }
 
 func (conn *tcpConnection) cleanCallbackMap() {
 	conn.mutex.Lock()
-	defer conn.mutex.Unlock()
+	answerMap := conn.answerMap
+	conn.answerMap = make(map[uint32]*connCallback)
+	executor := conn.executor
+	conn.mutex.Unlock()
 
-	for seqNum, callback := range conn.answerMap {
+	for seqNum, callback := range answerMap {
 
 		answer := newErrorAnswerWitSeqNum(seqNum, FPNN_EC_CORE_CONNECTION_CLOSED, "Connection is closed.")
-		go callAnswerCallback(answer, callback)
+		conn.stats.questCompleted(callback, FPNN_EC_CORE_CONNECTION_CLOSED)
+		executeAnswerCallback(executor, answer, callback)
 	}
 }
 
@@ -568,10 +687,18 @@ func (conn *tcpConnection) prepareECDHQuest() ([]byte, error) {
 	quest.Param("streamMode", true)
 
 	callback := &connCallback{}
-	callback.timeout = time.Now().Unix() + int64(Config.questTimeout/time.Second)
+	callback.deadline = time.Now().Add(conn.options.getQuestTimeout())
+	start := time.Now()
 	callback.callbackFunc = func(answer *Answer, errorCode int) {
+		conn.stats.handshake("key_exchange", errorCode == FPNN_EC_OK, time.Since(start))
 		if errorCode != FPNN_EC_OK {
-			conn.logger.Printf("[ERROR] Encryption handshake failed, errorCode: %d", errorCode)
+			err := fmt.Errorf("Key exchange failed, errorCode: %d.", errorCode)
+			conn.logError("Encryption handshake failed.", "errorCode", errorCode)
+			conn.clearEncryptedInfo()
+			conn.emitEvent(&ConnectionEvent{Type: ConnectionEventHandshakeFailed, Err: err})
+			conn.closeWithReason(CloseReasonHandshakeFailed, err)
+		} else {
+			conn.emitEvent(&ConnectionEvent{Type: ConnectionEventHandshakeSucceeded})
 		}
 	}
 
@@ -585,6 +712,8 @@ func (conn *tcpConnection) prepareECDHQuest() ([]byte, error) {
 	conn.seqNum += 1
 
 	if conn.connected {
+		callback.method = quest.method
+		callback.sentTime = time.Now()
 		conn.answerMap[quest.seqNum] = callback
 	} else {
 		conn.mutex.Unlock()
@@ -592,6 +721,7 @@ func (conn *tcpConnection) prepareECDHQuest() ([]byte, error) {
 	}
 	conn.mutex.Unlock()
 
+	conn.stats.questSent(quest.method, true)
 	return quest.Raw()
 }
 
@@ -618,12 +748,29 @@ func (conn *tcpConnection) sendQuest(quest *Quest, callback *connCallback) error
 	}
 
 	if callback != nil {
+		callback.method = quest.method
+		callback.sentTime = time.Now()
 		conn.answerMap[quest.seqNum] = callback
 	}
-
-	conn.writeChan <- binData
 	conn.mutex.Unlock()
 
+	if callback != nil && quest.handle != nil {
+		seqNum := quest.seqNum
+		quest.handle.track(func() {
+			conn.cancelQuestCallback(seqNum, callback)
+		})
+	}
+
+	if err := conn.enqueue(writeFrame{data: binData, handle: quest.handle}); err != nil {
+		if callback != nil && !conn.removeQuestCallback(quest, callback) {
+			//-- The callback has been called by cleanCallbackMap().
+			conn.stats.questSent(quest.method, true)
+			return nil
+		}
+		return err
+	}
+
+	conn.stats.questSent(quest.method, callback != nil)
 	return nil
 }
 
@@ -634,20 +781,90 @@ func (conn *tcpConnection) sendAnswer(answer *Answer) error {
 		return err
 	}
 
+	if !conn.isConnected() {
+		return errors.New("Connection is broken.")
+	}
+
+	return conn.enqueue(writeFrame{data: binData})
+}
+
+func (conn *tcpConnection) setTrySend(trySend bool) {
 	conn.mutex.Lock()
-	if !conn.connected {
-		conn.mutex.Unlock()
+	defer conn.mutex.Unlock()
+
+	conn.trySend = trySend
+}
+
+func (conn *tcpConnection) setExecutor(executor CallbackExecutor) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	conn.executor = executor
+}
+
+func (conn *tcpConnection) enqueue(frame writeFrame) error {
+
+	conn.mutex.Lock()
+	trySend := conn.trySend
+	conn.mutex.Unlock()
+
+	if trySend {
+		select {
+		case conn.writeChan <- frame:
+			return nil
+		case <-conn.closedChan:
+			return errors.New("Connection is broken.")
+		default:
+			return ErrWriteQueueFull
+		}
+	}
+
+	select {
+	case conn.writeChan <- frame:
+		return nil
+	case <-conn.closedChan:
 		return errors.New("Connection is broken.")
 	}
+}
+
+func (conn *tcpConnection) removeQuestCallback(quest *Quest, cb *connCallback) bool {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	if callback, ok := conn.answerMap[quest.seqNum]; ok && callback == cb {
+		delete(conn.answerMap, quest.seqNum)
+		conn.notifyAnswersDrained()
+		return true
+	}
+	return false
+}
+
+// Removes the callback of a quest which will not be waited, e.g. the loser of a hedged quest.
+func (conn *tcpConnection) dropQuestCallback(quest *Quest, cb *connCallback) bool {
+	if !conn.removeQuestCallback(quest, cb) {
+		return false
+	}
+
+	conn.stats.questCompleted(cb, FPNN_EC_SDK_QUEST_CANCELLED)
+	return true
+}
 
-	conn.writeChan <- binData
+// The first reason is kept if the connection is closed for several reasons.
+func (conn *tcpConnection) closeWithReason(reason CloseReason, err error) {
+	conn.mutex.Lock()
+	if conn.connected && conn.closeReason == CloseReasonUnknown {
+		conn.closeReason = reason
+		conn.closeErr = err
+	}
 	conn.mutex.Unlock()
 
-	return nil
+	conn.close()
 }
 
 func (conn *tcpConnection) close() {
 
+	conn.dialCancel()
+
 	conn.mutex.Lock()
 	defer conn.mutex.Unlock()
 
@@ -656,18 +873,35 @@ func (conn *tcpConnection) close() {
 		conn.activeClosed = true
 		err := conn.conn.Close()
 		if err != nil {
-			conn.logger.Printf("[ERROR] Close connection failed, err: %v", err)
+			conn.logError("Close connection failed.", "err", err)
 			return
 		}
 
 		conn.ticker.Stop()
 		conn.connected = false
+		close(conn.closedChan)
+
+		reason := conn.closeReason
+		closeErr := conn.closeErr
+		info := conn.info
+		pool := conn.questPool
 
 		conn.mutex.Unlock()
-		conn.closeSignChan <- true
+		conn.stats.disconnected()
+		if pool != nil {
+			pool.wakeUp()
+		}
 		conn.cleanCallbackMap()
+		conn.emitEvent(&ConnectionEvent{Type: ConnectionEventClosed, Reason: reason, Err: closeErr})
 		if conn.onClosed != nil {
-			go conn.onClosed(uint64(uintptr(unsafe.Pointer(conn))), endpoint)
+			conn.routines.executor().Execute(func() {
+				conn.onClosed(conn.connId, endpoint)
+			})
+		}
+		if conn.onClosedInfo != nil {
+			conn.routines.executor().Execute(func() {
+				conn.onClosedInfo(info)
+			})
 		}
 		conn.mutex.Lock()
 	}
@@ -0,0 +1,153 @@
+package fpnn
+
+import (
+	"strconv"
+	"time"
+)
+
+type ConnectionEventType int
+
+const (
+	ConnectionEventDialing ConnectionEventType = iota
+	ConnectionEventConnected
+	ConnectionEventConnectFailed
+	ConnectionEventHandshakeSucceeded
+	ConnectionEventHandshakeFailed
+	ConnectionEventKeepAliveLost
+	ConnectionEventReconnectScheduled
+	ConnectionEventClosed
+)
+
+func (eventType ConnectionEventType) String() string {
+	switch eventType {
+	case ConnectionEventDialing:
+		return "Dialing"
+	case ConnectionEventConnected:
+		return "Connected"
+	case ConnectionEventConnectFailed:
+		return "ConnectFailed"
+	case ConnectionEventHandshakeSucceeded:
+		return "HandshakeSucceeded"
+	case ConnectionEventHandshakeFailed:
+		return "HandshakeFailed"
+	case ConnectionEventKeepAliveLost:
+		return "KeepAliveLost"
+	case ConnectionEventReconnectScheduled:
+		return "ReconnectScheduled"
+	case ConnectionEventClosed:
+		return "Closed"
+	}
+	return "ConnectionEventType(" + strconv.Itoa(int(eventType)) + ")"
+}
+
+type CloseReason int
+
+const (
+	CloseReasonUnknown CloseReason = iota
+	CloseReasonPeerEOF
+	CloseReasonReadError
+	CloseReasonWriteError
+	CloseReasonDecodeError
+	CloseReasonKeepAliveTimeout
+	CloseReasonHandshakeFailed
+	CloseReasonUserClose
+)
+
+func (reason CloseReason) String() string {
+	switch reason {
+	case CloseReasonUnknown:
+		return "Unknown"
+	case CloseReasonPeerEOF:
+		return "PeerEOF"
+	case CloseReasonReadError:
+		return "ReadError"
+	case CloseReasonWriteError:
+		return "WriteError"
+	case CloseReasonDecodeError:
+		return "DecodeError"
+	case CloseReasonKeepAliveTimeout:
+		return "KeepAliveTimeout"
+	case CloseReasonHandshakeFailed:
+		return "HandshakeFailed"
+	case CloseReasonUserClose:
+		return "UserClose"
+	}
+	return "CloseReason(" + strconv.Itoa(int(reason)) + ")"
+}
+
+/*
+Fields which are not used by the event type are zero.
+
+	ConnId:		0 for ConnectionEventReconnectScheduled.
+	Reason:		for ConnectionEventClosed.
+	Err:		for ConnectionEventConnectFailed, ConnectionEventHandshakeFailed and ConnectionEventClosed.
+	Attempt:	for ConnectionEventReconnectScheduled, the number of the scheduled attempt, starting from 1.
+	Delay:		for ConnectionEventReconnectScheduled, the time to wait before the attempt.
+*/
+type ConnectionEvent struct {
+	Type     ConnectionEventType
+	ConnId   uint64
+	Endpoint string
+	Time     time.Time
+	Reason   CloseReason
+	Err      error
+	Attempt  int
+	Delay    time.Duration
+}
+
+type ConnectionEventListener interface {
+	OnConnectionEvent(event *ConnectionEvent)
+}
+
+type ConnectionEventListenerFunc func(event *ConnectionEvent)
+
+func (listener ConnectionEventListenerFunc) OnConnectionEvent(event *ConnectionEvent) {
+	listener(event)
+}
+
+//-----------------[ tcpConnection events ]-----------------//
+
+func (conn *tcpConnection) emitEvent(event *ConnectionEvent) {
+	if conn.events == nil {
+		return
+	}
+
+	event.ConnId = conn.connId
+	event.Endpoint = conn.endpoint
+	conn.events(event)
+}
+
+//-----------------[ TCPClient events ]-----------------//
+
+/*
+Events of the client are delivered to the listener one by one in order, in a goroutine other than the connection's.
+Set nil to remove the listener.
+*/
+func (client *TCPClient) SetConnectionEventListener(listener ConnectionEventListener) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.listener = listener
+	if listener != nil && client.eventQueue == nil {
+		client.eventQueue = newSerialExecutor(client.routines.executor())
+	}
+}
+
+func (client *TCPClient) emitEvent(event *ConnectionEvent) {
+	client.mutex.Lock()
+	listener := client.listener
+	queue := client.eventQueue
+	client.mutex.Unlock()
+
+	if listener == nil {
+		return
+	}
+
+	if len(event.Endpoint) == 0 {
+		event.Endpoint = client.endpoint
+	}
+	event.Time = time.Now()
+	queue.Execute(func() {
+		listener.OnConnectionEvent(event)
+	})
+}
@@ -0,0 +1,161 @@
+package fpnn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+type eventRecorder chan *ConnectionEvent
+
+func (recorder eventRecorder) OnConnectionEvent(event *ConnectionEvent) {
+	recorder <- event
+}
+
+func (recorder eventRecorder) expect(t *testing.T, eventType ConnectionEventType) *ConnectionEvent {
+	t.Helper()
+
+	select {
+	case event := <-recorder:
+		if event.Type != eventType {
+			t.Fatalf("unexpected event %v, expected %v", event.Type, eventType)
+		}
+		return event
+	case <-time.After(3 * time.Second):
+		t.Fatalf("event %v is not received", eventType)
+	}
+	return nil
+}
+
+func TestConnectionEvents(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	events := make(eventRecorder, 16)
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetConnectionEventListener(events)
+	client.SetReconnectPolicy(&ReconnectPolicy{InitialDelay: 10 * time.Millisecond, Proactive: true})
+	defer client.Close()
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	dialing := events.expect(t, ConnectionEventDialing)
+	connected := events.expect(t, ConnectionEventConnected)
+	if dialing.Endpoint != server.endpoint() || connected.ConnId == 0 || connected.ConnId != dialing.ConnId {
+		t.Fatalf("unexpected connected event: %+v", connected)
+	}
+
+	server.dropConnections()
+	closed := events.expect(t, ConnectionEventClosed)
+	if closed.Reason != CloseReasonPeerEOF || closed.ConnId != connected.ConnId {
+		t.Fatalf("unexpected closed event: %+v", closed)
+	}
+
+	if scheduled := events.expect(t, ConnectionEventReconnectScheduled); scheduled.Attempt != 1 {
+		t.Fatalf("unexpected reconnect scheduled event: %+v", scheduled)
+	}
+	events.expect(t, ConnectionEventDialing)
+	events.expect(t, ConnectionEventConnected)
+
+	client.Close()
+	if closed := events.expect(t, ConnectionEventClosed); closed.Reason != CloseReasonUserClose {
+		t.Fatalf("unexpected closed event: %+v", closed)
+	}
+
+	failed := NewTCPClient(closedEndpoint(t))
+	failed.SetLogger(testLogger)
+	failed.SetConnectionEventListener(events)
+	failed.Connect()
+
+	events.expect(t, ConnectionEventDialing)
+	if event := events.expect(t, ConnectionEventConnectFailed); event.Err == nil {
+		t.Fatalf("connect failed event without error")
+	}
+}
+
+func TestKeepAliveLostEvent(t *testing.T) {
+	server := newTestServer(t, func(quest *Quest) *Answer {
+		return nil
+	})
+
+	events := make(eventRecorder, 16)
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetAutoReconnect(false)
+	client.SetKeepAliveTimeoutSecond(100 * time.Millisecond)
+	client.SetKeepAliveIntervalSecond(100 * time.Millisecond)
+	client.SetKeepAliveMaxPingRetryCount(1)
+	client.SetConnectionEventListener(events)
+	defer client.Close()
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	events.expect(t, ConnectionEventDialing)
+	events.expect(t, ConnectionEventConnected)
+	events.expect(t, ConnectionEventKeepAliveLost)
+	if closed := events.expect(t, ConnectionEventClosed); closed.Reason != CloseReasonKeepAliveTimeout {
+		t.Fatalf("unexpected closed event: %+v", closed)
+	}
+}
+
+func TestKeyExchangeFailureClosesConnection(t *testing.T) {
+	server := newTestServer(t, func(quest *Quest) *Answer {
+		//-- The key exchange is never answered, and fails with timeout.
+		if quest.Method() == "*key" {
+			return nil
+		}
+		return echoHandler(quest)
+	})
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key failed, err: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal key failed, err: %v", err)
+	}
+
+	events := make(eventRecorder, 16)
+	closed := make(chan *ConnectionInfo, 1)
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetAutoReconnect(false)
+	client.SetQuestTimeOut(200 * time.Millisecond)
+	client.SetConnectionEventListener(events)
+	client.SetOnClosedInfoCallback(func(info *ConnectionInfo) {
+		closed <- info
+	})
+	defer client.Close()
+
+	if err := client.EnableEncryptor(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})); err != nil {
+		t.Fatalf("enable encryptor failed, err: %v", err)
+	}
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	events.expect(t, ConnectionEventDialing)
+	events.expect(t, ConnectionEventConnected)
+	events.expect(t, ConnectionEventHandshakeFailed)
+	if event := events.expect(t, ConnectionEventClosed); event.Reason != CloseReasonHandshakeFailed {
+		t.Fatalf("unexpected close reason: %v", event.Reason)
+	}
+
+	select {
+	case info := <-closed:
+		if info.Encrypted || info.AESKeyBits != 0 {
+			t.Fatalf("connection failed in key exchange is reported as encrypted: %+v", info)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("connection is not closed")
+	}
+}
@@ -0,0 +1,129 @@
+package fpnn
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+var lastConnId uint64
+
+// Connection ids are unique in the process, and start from 1.
+func nextConnId() uint64 {
+	return atomic.AddUint64(&lastConnId, 1)
+}
+
+/*
+Fields are not changed after the connection is established.
+
+	LocalAddr, RemoteAddr:	nil if the connection is not established.
+	ConnectedTime:		zero if the connection is not established.
+	Curve:			ECC curve name of the server key, e.g. "secp256k1". Empty if not encrypted.
+	AESKeyBits:		128 or 256. 0 if not encrypted.
+*/
+type ConnectionInfo struct {
+	ConnId        uint64
+	Endpoint      string
+	LocalAddr     net.Addr
+	RemoteAddr    net.Addr
+	ConnectedTime time.Time
+	Encrypted     bool
+	Curve         string
+	AESKeyBits    int
+}
+
+//-----------------[ tcpConnection info ]-----------------//
+
+// Called with conn.mutex locked.
+func (conn *tcpConnection) buildInfo() *ConnectionInfo {
+	info := &ConnectionInfo{
+		ConnId:        conn.connId,
+		Endpoint:      conn.endpoint,
+		ConnectedTime: conn.connectedTime,
+	}
+
+	if conn.conn != nil {
+		info.LocalAddr = conn.conn.LocalAddr()
+		info.RemoteAddr = conn.conn.RemoteAddr()
+	}
+
+	if conn.encryptInfo != nil {
+		info.Encrypted = true
+		info.Curve = conn.encryptInfo.curveName
+		info.AESKeyBits = conn.encryptInfo.aesKeyBits
+	}
+	return info
+}
+
+// The info is replaced instead of changed, as the returned ones are not changed.
+func (conn *tcpConnection) clearEncryptedInfo() {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	if conn.info != nil {
+		info := *conn.info
+		info.Encrypted = false
+		info.Curve = ""
+		info.AESKeyBits = 0
+		conn.info = &info
+	}
+}
+
+func (conn *tcpConnection) connectionInfo() *ConnectionInfo {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	if conn.info == nil {
+		return conn.buildInfo()
+	}
+	return conn.info
+}
+
+//-----------------[ Quest connection info ]-----------------//
+
+/*
+Returns the connection which the server pushed quest arrived on. Returns nil for the quests created locally.
+*/
+func (quest *Quest) ConnectionInfo() *ConnectionInfo {
+	if quest.conn == nil {
+		return nil
+	}
+	return quest.conn.connectionInfo()
+}
+
+//-----------------[ TCPClient connection info ]-----------------//
+
+/*
+Returns the info of the current connection, or nil if the client has no connection.
+*/
+func (client *TCPClient) ConnectionInfo() *ConnectionInfo {
+	client.mutex.Lock()
+	conn := client.conn
+	client.mutex.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.connectionInfo()
+}
+
+/*
+Same as SetOnConnectedCallback, but reports the connection info.
+For the failed connection, only ConnId and Endpoint are set.
+*/
+func (client *TCPClient) SetOnConnectedInfoCallback(onConnected func(info *ConnectionInfo, connected bool)) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.onConnectedInfo = onConnected
+}
+
+/*
+Same as SetOnClosedCallback, but reports the connection info.
+*/
+func (client *TCPClient) SetOnClosedInfoCallback(onClosed func(info *ConnectionInfo)) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.onClosedInfo = onClosed
+}
@@ -0,0 +1,91 @@
+package fpnn
+
+import (
+	"testing"
+	"time"
+)
+
+type infoProcessor chan *ConnectionInfo
+
+func (processor infoProcessor) Process(method string) func(*Quest) (*Answer, error) {
+	return func(quest *Quest) (*Answer, error) {
+		processor <- quest.ConnectionInfo()
+		return nil, nil
+	}
+}
+
+func TestConnectionInfo(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	connected := make(chan *ConnectionInfo, 1)
+	closed := make(chan *ConnectionInfo, 1)
+	pushed := make(infoProcessor, 1)
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetAutoReconnect(false)
+	client.SetQuestProcessor(pushed)
+	client.SetOnConnectedInfoCallback(func(info *ConnectionInfo, ok bool) {
+		connected <- info
+	})
+	client.SetOnClosedInfoCallback(func(info *ConnectionInfo) {
+		closed <- info
+	})
+	defer client.Close()
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	info := <-connected
+	if info.ConnId == 0 || info.Endpoint != server.endpoint() || info.Encrypted || info.ConnectedTime.IsZero() {
+		t.Fatalf("unexpected connection info: %+v", info)
+	}
+	if info.RemoteAddr == nil || info.RemoteAddr.String() != server.endpoint() || info.LocalAddr == nil {
+		t.Fatalf("unexpected connection addresses: %+v", info)
+	}
+	if current := client.ConnectionInfo(); current != info {
+		t.Fatalf("unexpected current connection info: %+v", current)
+	}
+
+	server.pushQuest(t, NewOneWayQuest("push"))
+	select {
+	case questInfo := <-pushed:
+		if questInfo != info {
+			t.Fatalf("unexpected connection info of quest: %+v", questInfo)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("server push quest is not received")
+	}
+
+	if NewQuest("local").ConnectionInfo() != nil {
+		t.Fatalf("local quest has connection info")
+	}
+
+	server.dropConnections()
+	select {
+	case closedInfo := <-closed:
+		if closedInfo != info {
+			t.Fatalf("unexpected closed connection info: %+v", closedInfo)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("closed callback is not called")
+	}
+
+	if !client.Connect() {
+		t.Fatalf("reconnect failed")
+	}
+	if next := <-connected; next.ConnId <= info.ConnId {
+		t.Fatalf("connection id is not increased: %d -> %d", info.ConnId, next.ConnId)
+	}
+}
+
+func TestEncryptedConnectionInfo(t *testing.T) {
+	conn := newTCPConnection(NewLeveledLogger(testLogger, LogLevelInfo), nil, nil, nil, nil, nil)
+	conn.encryptInfo = &encryptionInfo{aesKeyBits: 128, curveName: "secp256k1"}
+
+	info := conn.connectionInfo()
+	if !info.Encrypted || info.Curve != "secp256k1" || info.AESKeyBits != 128 || info.LocalAddr != nil {
+		t.Fatalf("unexpected connection info: %+v", info)
+	}
+}
@@ -0,0 +1,85 @@
+package fpnn
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTrySendWithStalledPeer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		//-- Never read, so the client's socket and write queue are filled up.
+		time.Sleep(5 * time.Second)
+	}()
+
+	client := NewTCPClient(listener.Addr().String())
+	client.SetLogger(testLogger)
+	client.SetTrySendMode(true)
+	defer client.Close()
+
+	payload := make([]byte, 1024*1024)
+	for i := 0; i < 1000; i++ {
+		quest := NewOneWayQuest("stalled")
+		quest.Param("data", payload)
+
+		_, err := client.SendQuest(quest)
+		if err == ErrWriteQueueFull {
+			break
+		}
+		if err != nil {
+			t.Fatalf("send quest failed, err: %v", err)
+		}
+		if i == 999 {
+			t.Fatalf("write queue never became full")
+		}
+	}
+
+	start := time.Now()
+	if !client.IsConnected() {
+		t.Fatalf("connection should be alive")
+	}
+	if _, err := client.SendQuest(NewOneWayQuest("stalled")); err != ErrWriteQueueFull {
+		t.Fatalf("expect write queue full error, err: %v", err)
+	}
+	if cost := time.Since(start); cost > 100*time.Millisecond {
+		t.Fatalf("client is frozen by stalled peer, cost: %v", cost)
+	}
+}
+
+func TestWriteBatchKeepsFrames(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetWriteBatch(16, 0, time.Millisecond)
+	defer client.Close()
+
+	const count = 500
+	done := make(chan bool, count)
+	for i := 0; i < count; i++ {
+		go func(idx int) {
+			quest := NewQuest("echo")
+			quest.Param("idx", idx)
+			answer, err := client.SendQuest(quest)
+			done <- err == nil && answer.WantInt("idx") == idx
+		}(i)
+	}
+
+	for i := 0; i < count; i++ {
+		if !<-done {
+			t.Fatalf("batched quest got wrong answer")
+		}
+	}
+}
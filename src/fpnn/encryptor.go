@@ -421,8 +421,16 @@ func (enc *encryptor) encrypt(data []byte) []byte {
 	return encBuf
 }
 
+func (enc *encryptor) encryptInPlace(data []byte) {
+	enc.encrypter.XORKeyStream(data, data)
+}
+
 func (dec *encryptor) decrypt(data []byte) []byte {
 	decBuf := make([]byte, len(data))
 	dec.decrypter.XORKeyStream(decBuf, data)
 	return decBuf
 }
+
+func (dec *encryptor) decryptInPlace(data []byte) {
+	dec.decrypter.XORKeyStream(data, data)
+}
@@ -36,4 +36,7 @@ const (
 	//for other
 	FPNN_EC_ZIP_COMPRESS				= 30001
 	FPNN_EC_ZIP_DECOMPRESS				= 30002
+
+	//for sdk
+	FPNN_EC_SDK_QUEST_CANCELLED			= 40001
 )
\ No newline at end of file
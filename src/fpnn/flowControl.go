@@ -0,0 +1,252 @@
+package fpnn
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRateLimited           = errors.New("Quest is rejected by rate limiter.")
+	ErrTooManyInFlightQuests = errors.New("Too many in-flight quests.")
+)
+
+/*
+FlowControlPolicy bounds the sending rate and the in-flight quests.
+
+	Rate:			quests per second. 0 means unlimited.
+	Burst:			size of the token bucket. 0 means max(1, Rate).
+	MaxInFlight:	max quests waiting for answers. 0 means unlimited.
+	Wait:			wait for a token or an in-flight slot until the quest timeout, instead of failing fast.
+*/
+type FlowControlPolicy struct {
+	Rate        float64
+	Burst       int
+	MaxInFlight int
+	Wait        bool
+}
+
+//-----------------[ token bucket ]-----------------//
+
+type tokenBucket struct {
+	mutex      sync.Mutex
+	rate       float64
+	burst      float64
+	tokens     float64
+	lastUpdate time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	bucket := &tokenBucket{rate: rate, burst: float64(burst)}
+	if bucket.burst <= 0 {
+		bucket.burst = math.Max(1, math.Ceil(rate))
+	}
+	bucket.tokens = bucket.burst
+	bucket.lastUpdate = time.Now()
+	return bucket
+}
+
+// Returns the time to wait for the reserved token.
+func (bucket *tokenBucket) reserve(wait bool, deadline time.Time) (time.Duration, error) {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	now := time.Now()
+	bucket.tokens += now.Sub(bucket.lastUpdate).Seconds() * bucket.rate
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+	bucket.lastUpdate = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens -= 1
+		return 0, nil
+	}
+
+	if !wait {
+		return 0, ErrRateLimited
+	}
+
+	delay := time.Duration((1 - bucket.tokens) / bucket.rate * float64(time.Second))
+	if now.Add(delay).After(deadline) {
+		return 0, ErrRateLimited
+	}
+
+	bucket.tokens -= 1
+	return delay, nil
+}
+
+//-----------------[ flow controller ]-----------------//
+
+type flowController struct {
+	policy   FlowControlPolicy
+	bucket   *tokenBucket
+	inFlight chan struct{}
+}
+
+func newFlowController(policy *FlowControlPolicy) *flowController {
+	controller := &flowController{policy: *policy}
+	if policy.Rate > 0 {
+		controller.bucket = newTokenBucket(policy.Rate, policy.Burst)
+	}
+	if policy.MaxInFlight > 0 {
+		controller.inFlight = make(chan struct{}, policy.MaxInFlight)
+	}
+	return controller
+}
+
+/*
+The in-flight slot is taken first, so quests rejected for too many in-flight quests do not consume the rate.
+The waiting stops when cancelled is closed, or the client is closed.
+*/
+func (controller *flowController) acquire(deadline time.Time, cancelled <-chan struct{}, closed <-chan struct{}) error {
+
+	if err := controller.acquireInFlight(deadline, cancelled, closed); err != nil {
+		return err
+	}
+
+	if controller.bucket != nil {
+		delay, err := controller.bucket.reserve(controller.policy.Wait, deadline)
+		if err == nil && delay > 0 {
+			err = waitFlowControl(time.NewTimer(delay), cancelled, closed)
+		}
+		if err != nil {
+			controller.release()
+			return err
+		}
+	}
+	return nil
+}
+
+func waitFlowControl(timer *time.Timer, cancelled <-chan struct{}, closed <-chan struct{}) error {
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-cancelled:
+		return ErrQuestCancelled
+	case <-closed:
+		return ErrClientClosed
+	}
+}
+
+func (controller *flowController) acquireInFlight(deadline time.Time, cancelled <-chan struct{}, closed <-chan struct{}) error {
+
+	if controller.inFlight == nil {
+		return nil
+	}
+
+	select {
+	case controller.inFlight <- struct{}{}:
+		return nil
+	default:
+		if !controller.policy.Wait {
+			return ErrTooManyInFlightQuests
+		}
+	}
+
+	wait := time.Until(deadline)
+	if wait <= 0 {
+		return ErrTooManyInFlightQuests
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case controller.inFlight <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrTooManyInFlightQuests
+	case <-cancelled:
+		return ErrQuestCancelled
+	case <-closed:
+		return ErrClientClosed
+	}
+}
+
+func (controller *flowController) release() {
+	if controller.inFlight != nil {
+		<-controller.inFlight
+	}
+}
+
+//-----------------[ TCPClient flow control ]-----------------//
+
+/*
+Set nil policy to disable the flow control of the client.
+*/
+func (client *TCPClient) SetFlowControl(policy *FlowControlPolicy) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if policy == nil {
+		client.flowController = nil
+	} else {
+		client.flowController = newFlowController(policy)
+	}
+}
+
+/*
+The method flow control overrides the client flow control for the method.
+Set nil policy to remove the override.
+*/
+func (client *TCPClient) SetMethodFlowControl(method string, policy *FlowControlPolicy) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if policy == nil {
+		delete(client.flowControllers, method)
+		return
+	}
+
+	if client.flowControllers == nil {
+		client.flowControllers = make(map[string]*flowController)
+	}
+	client.flowControllers[method] = newFlowController(policy)
+}
+
+func (client *TCPClient) getFlowController(method string) *flowController {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if controller, ok := client.flowControllers[method]; ok {
+		return controller
+	}
+	return client.flowController
+}
+
+func (client *TCPClient) sendQuestWithFlowControl(quest *Quest, cb *connCallback, controller *flowController) error {
+
+	var deadline time.Time
+	if cb != nil {
+		deadline = cb.deadline
+	} else {
+		deadline = time.Now().Add(client.defaultQuestTimeout())
+	}
+
+	if err := controller.acquire(deadline, quest.Context().Done(), client.routines.closedChan()); err != nil {
+		return err
+	}
+
+	if cb == nil {
+		err := client.sendQuestWithPolicies(quest, nil)
+		controller.release()
+		return err
+	}
+
+	wrapped := &connCallback{}
+	wrapped.deadline = cb.deadline
+	wrapped.callbackFunc = func(answer *Answer, errorCode int) {
+		controller.release()
+		callAnswerCallback(answer, cb)
+	}
+
+	err := client.sendQuestWithPolicies(quest, wrapped)
+	if err != nil {
+		controller.release()
+	}
+	return err
+}
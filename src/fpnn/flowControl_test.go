@@ -0,0 +1,113 @@
+package fpnn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaxInFlight(t *testing.T) {
+	server := newTestServer(t, func(quest *Quest) *Answer {
+		time.Sleep(100 * time.Millisecond)
+		return NewAnswer(quest)
+	})
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetFlowControl(&FlowControlPolicy{MaxInFlight: 1})
+	defer client.Close()
+
+	done := make(chan int, 1)
+	if err := client.SendQuestWithLambda(NewQuest("test"), func(answer *Answer, errorCode int) { done <- errorCode }); err != nil {
+		t.Fatalf("send quest failed, err: %v", err)
+	}
+	if err := client.SendQuestWithLambda(NewQuest("test"), func(answer *Answer, errorCode int) {}); err != ErrTooManyInFlightQuests {
+		t.Fatalf("expect in-flight limit error, err: %v", err)
+	}
+
+	<-done
+	if _, err := client.SendQuest(NewQuest("test")); err != nil {
+		t.Fatalf("slot is not released, err: %v", err)
+	}
+
+	client.SetMethodFlowControl("other", &FlowControlPolicy{MaxInFlight: 1, Wait: true})
+	client.SendQuestWithLambda(NewQuest("other"), func(answer *Answer, errorCode int) {})
+	if _, err := client.SendQuest(NewQuest("other")); err != nil {
+		t.Fatalf("waiting for in-flight slot failed, err: %v", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetFlowControl(&FlowControlPolicy{Rate: 10, Burst: 1})
+	defer client.Close()
+
+	if _, err := client.SendQuest(NewQuest("test")); err != nil {
+		t.Fatalf("send quest failed, err: %v", err)
+	}
+	if _, err := client.SendQuest(NewQuest("test")); err != ErrRateLimited {
+		t.Fatalf("expect rate limited error, err: %v", err)
+	}
+
+	client.SetFlowControl(&FlowControlPolicy{Rate: 10, Burst: 1, Wait: true})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := client.SendQuest(NewQuest("test")); err != nil {
+			t.Fatalf("send quest failed, err: %v", err)
+		}
+	}
+	if cost := time.Since(start); cost < 150*time.Millisecond {
+		t.Fatalf("rate limiter did not delay sends, cost: %v", cost)
+	}
+}
+
+func TestInFlightRejectionKeepsTokens(t *testing.T) {
+	controller := newFlowController(&FlowControlPolicy{Rate: 1, Burst: 2, MaxInFlight: 1})
+	deadline := time.Now().Add(time.Second)
+
+	if err := controller.acquire(deadline, nil, nil); err != nil {
+		t.Fatalf("first acquire failed, err: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := controller.acquire(deadline, nil, nil); err != ErrTooManyInFlightQuests {
+			t.Fatalf("unexpected acquire result: %v", err)
+		}
+	}
+
+	controller.release()
+	if err := controller.acquire(deadline, nil, nil); err != nil {
+		t.Fatalf("token is consumed by rejected quests, err: %v", err)
+	}
+}
+
+func TestFlowControlWaitStopsWhenClosed(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetFlowControl(&FlowControlPolicy{Rate: 1, Burst: 1, Wait: true})
+
+	if _, err := client.SendQuest(NewQuest("test")); err != nil {
+		t.Fatalf("first quest failed: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := client.SendQuest(NewQuest("test"), 5*time.Second)
+		errChan <- err
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	client.Close()
+
+	select {
+	case err := <-errChan:
+		if err != ErrClientClosed {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("waiting quest is not stopped by close")
+	}
+}
@@ -0,0 +1,89 @@
+// Test helpers of the FPNN Go SDK.
+package fpnntest
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// All goroutines of the SDK are run by these functions of package fpnn.
+const (
+	groupRunFunc  = "github.com/highras/fpnn-sdk-go/src/fpnn.(*goroutineGroup).run("
+	groupDoneFunc = "github.com/highras/fpnn-sdk-go/src/fpnn.(*goroutineGroup).done("
+)
+
+/*
+CheckGoroutineLeaks records the goroutines of the SDK which are running now, and returns a function
+which reports the SDK goroutines started after that and still running. Usage:
+
+	defer fpnntest.CheckGoroutineLeaks(t)()
+
+All clients created after calling CheckGoroutineLeaks should be closed before the returned function is called.
+*/
+func CheckGoroutineLeaks(t testing.TB) func() {
+	existed := make(map[string]bool)
+	for _, routine := range sdkGoroutines() {
+		existed[goroutineId(routine)] = true
+	}
+
+	return func() {
+		t.Helper()
+
+		for _, routine := range sdkGoroutines() {
+			if !existed[goroutineId(routine)] {
+				t.Errorf("leaked goroutine:\n%s", routine)
+			}
+		}
+	}
+}
+
+func sdkGoroutines() []string {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var routines []string
+	for _, routine := range bytes.Split(buf, []byte("\n\n")) {
+		if isSDKGoroutine(string(routine)) {
+			routines = append(routines, string(routine))
+		}
+	}
+	return routines
+}
+
+/*
+The goroutines which have been counted as exited by the SDK, but not returned yet, are skipped:
+the ones returning from run(), or in the deferred done().
+*/
+func isSDKGoroutine(routine string) bool {
+	lines := strings.Split(routine, "\n")
+	for i := 1; i < len(lines); i += 2 {
+		if strings.HasPrefix(lines[i], groupDoneFunc) {
+			return false
+		}
+		if strings.HasPrefix(lines[i], groupRunFunc) {
+			return i > 1
+		}
+	}
+	return false
+}
+
+// The first line is like "goroutine 18 [running]:".
+func goroutineId(routine string) string {
+	line := routine
+	if idx := strings.IndexByte(routine, '\n'); idx >= 0 {
+		line = routine[:idx]
+	}
+	if idx := strings.IndexByte(line, '['); idx >= 0 {
+		line = line[:idx]
+	}
+	return strings.TrimSpace(line)
+}
@@ -0,0 +1,226 @@
+package fpnn
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+HedgePolicy sends a duplicate quest if no answer arrives within Delay. The first successful answer wins.
+
+	Delay:			time to wait before sending the hedged quest.
+	MaxExtraLoad:	max ratio of hedged quests to all quests of the method. 0 means 0.1.
+					The ratio counts the quests sent so far, so with 0.1 the first 9 quests are never hedged.
+	Backups:		clients which the hedged quests are sent to, in turn. The client itself is skipped.
+					A hedged quest on the same connection does not help, so at least one backup is required.
+*/
+type HedgePolicy struct {
+	Delay        time.Duration
+	MaxExtraLoad float64
+	Backups      []*TCPClient
+}
+
+type hedgeState struct {
+	total  int64
+	hedged int64
+	next   uint32
+	policy HedgePolicy
+}
+
+func (state *hedgeState) acquire() bool {
+	for {
+		total := atomic.LoadInt64(&state.total)
+		hedged := atomic.LoadInt64(&state.hedged)
+		if float64(hedged+1) > state.policy.MaxExtraLoad*float64(total) {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt64(&state.hedged, hedged, hedged+1) {
+			return true
+		}
+	}
+}
+
+func (state *hedgeState) backup() *TCPClient {
+	idx := atomic.AddUint32(&state.next, 1)
+	return state.policy.Backups[int(idx)%len(state.policy.Backups)]
+}
+
+//-----------------[ hedged quest ]-----------------//
+
+type hedgedAttempt struct {
+	client   *TCPClient
+	quest    *Quest
+	callback *connCallback
+	sent     bool
+}
+
+type hedgedQuest struct {
+	mutex    sync.Mutex
+	callback *connCallback
+	deadline time.Time
+	attempts []*hedgedAttempt
+	pending  int
+	done     bool
+	stop     func()
+}
+
+func (hq *hedgedQuest) send(client *TCPClient, quest *Quest) error {
+	cb := &connCallback{}
+	attempt := &hedgedAttempt{client: client, quest: quest, callback: cb}
+
+	cb.deadline = hq.deadline
+	cb.callbackFunc = func(answer *Answer, errorCode int) {
+		hq.onAnswer(attempt, answer, errorCode)
+	}
+
+	hq.mutex.Lock()
+	if hq.done {
+		hq.mutex.Unlock()
+		return nil
+	}
+	hq.attempts = append(hq.attempts, attempt)
+	hq.pending += 1
+	hq.mutex.Unlock()
+
+	err := client.sendQuestOnce(quest, cb)
+
+	hq.mutex.Lock()
+	if err != nil {
+		hq.pending -= 1
+		hq.mutex.Unlock()
+		return err
+	}
+
+	attempt.sent = true
+	dropped := hq.done
+	hq.mutex.Unlock()
+
+	if dropped {
+		client.dropPendingQuest(quest, cb)
+	}
+	return nil
+}
+
+func (hq *hedgedQuest) onAnswer(attempt *hedgedAttempt, answer *Answer, errorCode int) {
+
+	hq.mutex.Lock()
+	if hq.done {
+		hq.mutex.Unlock()
+		return
+	}
+
+	hq.pending -= 1
+	if errorCode != FPNN_EC_OK && hq.pending > 0 {
+		hq.mutex.Unlock()
+		return
+	}
+
+	hq.done = true
+	if hq.stop != nil {
+		hq.stop()
+	}
+
+	var losers []*hedgedAttempt
+	for _, other := range hq.attempts {
+		if other != attempt && other.sent {
+			losers = append(losers, other)
+		}
+	}
+	hq.mutex.Unlock()
+
+	for _, loser := range losers {
+		loser.client.dropPendingQuest(loser.quest, loser.callback)
+	}
+
+	callAnswerCallback(answer, hq.callback)
+}
+
+func (hq *hedgedQuest) hedge(client *TCPClient, quest *Quest, state *hedgeState) {
+
+	hq.mutex.Lock()
+	stop := hq.done || hq.pending == 0
+	hq.mutex.Unlock()
+
+	if stop || client.isClosed() || quest.handle.isCancelled() || !state.acquire() {
+		return
+	}
+
+	backup := state.backup()
+	if err := hq.send(backup, quest.clone()); err != nil {
+		client.activeLeveledLogger().Error("Send hedged quest failed.", "endpoint", backup.Endpoint(), "method", quest.method, "err", err)
+	}
+}
+
+//-----------------[ TCPClient hedge policies ]-----------------//
+
+/*
+Hedging is opt-in per method, and only applies to two-way quests.
+Set nil policy, or a policy without backups, to remove the hedge policy of the method.
+*/
+func (client *TCPClient) SetHedgePolicy(method string, policy *HedgePolicy) {
+	var backups []*TCPClient
+	if policy != nil {
+		for _, backup := range policy.Backups {
+			if backup != nil && backup != client {
+				backups = append(backups, backup)
+			}
+		}
+	}
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if policy == nil || policy.Delay <= 0 || len(backups) == 0 {
+		delete(client.hedgePolicies, method)
+		return
+	}
+
+	state := &hedgeState{policy: *policy}
+	state.policy.Backups = backups
+	if state.policy.MaxExtraLoad <= 0 {
+		state.policy.MaxExtraLoad = 0.1
+	}
+
+	if client.hedgePolicies == nil {
+		client.hedgePolicies = make(map[string]*hedgeState)
+	}
+	client.hedgePolicies[method] = state
+}
+
+func (client *TCPClient) getHedgeState(method string) *hedgeState {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.hedgePolicies[method]
+}
+
+func (client *TCPClient) sendQuestAttempt(quest *Quest, cb *connCallback) error {
+	if cb != nil && quest.isTwoWay {
+		if state := client.getHedgeState(quest.method); state != nil {
+			return client.sendHedgedQuest(quest, cb, state)
+		}
+	}
+	return client.sendQuestOnce(quest, cb)
+}
+
+func (client *TCPClient) sendHedgedQuest(quest *Quest, cb *connCallback, state *hedgeState) error {
+
+	atomic.AddInt64(&state.total, 1)
+
+	hq := &hedgedQuest{callback: cb, deadline: cb.deadline}
+	if err := hq.send(client, quest); err != nil {
+		return err
+	}
+
+	hq.mutex.Lock()
+	if !hq.done {
+		hq.stop = client.routines.afterFunc(state.policy.Delay, func() {
+			hq.hedge(client, quest, state)
+		})
+	}
+	hq.mutex.Unlock()
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package fpnn
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgedQuest(t *testing.T) {
+	primaryServer := newTestServer(t, func(quest *Quest) *Answer {
+		time.Sleep(500 * time.Millisecond)
+		answer := NewAnswer(quest)
+		answer.Param("from", "primary")
+		return answer
+	})
+	backupServer := newTestServer(t, func(quest *Quest) *Answer {
+		answer := NewAnswer(quest)
+		answer.Param("from", "backup")
+		return answer
+	})
+
+	backup := NewTCPClient(backupServer.endpoint())
+	backup.SetLogger(testLogger)
+	defer backup.Close()
+
+	client := NewTCPClient(primaryServer.endpoint())
+	client.SetLogger(testLogger)
+	client.SetHedgePolicy("read", &HedgePolicy{Delay: 50 * time.Millisecond, MaxExtraLoad: 1, Backups: []*TCPClient{backup}})
+	defer client.Close()
+
+	start := time.Now()
+	answer, err := client.SendQuest(NewQuest("read"))
+	if err != nil || answer.IsException() {
+		t.Fatalf("hedged quest failed, answer: %v, err: %v", answer, err)
+	}
+	if from, _ := answer.GetString("from"); from != "backup" {
+		t.Fatalf("expect answer from backup, got %s", from)
+	}
+	if cost := time.Since(start); cost >= 500*time.Millisecond {
+		t.Fatalf("hedged quest cost %v", cost)
+	}
+
+	client.conn.mutex.Lock()
+	pending := len(client.conn.answerMap)
+	client.conn.mutex.Unlock()
+	if pending != 0 {
+		t.Fatalf("loser callback is not dropped, pending: %d", pending)
+	}
+	if inFlight := atomic.LoadInt64(&client.stats.inFlight); inFlight != 0 {
+		t.Fatalf("in-flight gauge is not decreased for the loser, in-flight: %d", inFlight)
+	}
+
+	client.SetHedgePolicy("read", &HedgePolicy{Delay: 50 * time.Millisecond, MaxExtraLoad: 0.01, Backups: []*TCPClient{backup}})
+	answer, err = client.SendQuest(NewQuest("read"))
+	if from, _ := answer.GetString("from"); err != nil || from != "primary" {
+		t.Fatalf("hedge load cap is not honored, answer: %v, err: %v", answer, err)
+	}
+}
+
+func TestHedgePolicyRequiresBackups(t *testing.T) {
+	client := NewTCPClient("localhost:12321")
+
+	client.SetHedgePolicy("read", &HedgePolicy{Delay: 50 * time.Millisecond})
+	if client.getHedgeState("read") != nil {
+		t.Fatalf("hedge policy without backups is set")
+	}
+
+	client.SetHedgePolicy("read", &HedgePolicy{Delay: 50 * time.Millisecond, Backups: []*TCPClient{client}})
+	if client.getHedgeState("read") != nil {
+		t.Fatalf("hedge policy backed up by the client itself is set")
+	}
+}
+
+func TestHedgeAcquireIsBounded(t *testing.T) {
+	state := &hedgeState{total: 100, policy: HedgePolicy{MaxExtraLoad: 0.1}}
+
+	var acquired int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if state.acquire() {
+				atomic.AddInt64(&acquired, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired != 10 || state.hedged != 10 {
+		t.Fatalf("acquired %d hedges, hedged %d, expect 10", acquired, state.hedged)
+	}
+}
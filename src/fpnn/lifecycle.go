@@ -0,0 +1,235 @@
+package fpnn
+
+import (
+	"reflect"
+	"runtime"
+	"sync"
+	"time"
+)
+
+/*
+Tracks the goroutines of a client and its connections, so Close() can wait for them.
+
+The goroutines running user code, such as quest handlers and answer callbacks, are tracked too. They run the user code
+by call(). Close() called in the user code can not wait for its own goroutine, so it only waits for the goroutines
+which are not running user code.
+
+The gate is closed by Close(), then no connection can be started until Close() returns.
+*/
+type goroutineGroup struct {
+	mutex   sync.Mutex
+	changed *sync.Cond
+	running int
+	calling int
+	waiting int
+	closed  bool
+	closing chan struct{}
+	timers  map[*time.Timer]func()
+}
+
+// Requires group.mutex.
+func (group *goroutineGroup) notify() {
+	if group.changed != nil {
+		group.changed.Broadcast()
+	}
+}
+
+func (group *goroutineGroup) start(task func()) {
+	group.mutex.Lock()
+	group.running += 1
+	group.mutex.Unlock()
+
+	go group.run(task)
+}
+
+// Starts all tasks, or none of them if the gate is closed.
+func (group *goroutineGroup) startLoops(tasks ...func()) bool {
+	group.mutex.Lock()
+	if group.closed {
+		group.mutex.Unlock()
+		return false
+	}
+	group.running += len(tasks)
+	group.mutex.Unlock()
+
+	for _, task := range tasks {
+		go group.run(task)
+	}
+	return true
+}
+
+func (group *goroutineGroup) run(task func()) {
+	defer group.done()
+	task()
+}
+
+func (group *goroutineGroup) done() {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+
+	group.running -= 1
+	group.notify()
+}
+
+// Runs the user code in a tracked goroutine.
+func (group *goroutineGroup) call(task func()) {
+	group.mutex.Lock()
+	group.calling += 1
+	group.notify()
+	group.mutex.Unlock()
+
+	defer func() {
+		group.mutex.Lock()
+		group.calling -= 1
+		group.notify()
+		group.mutex.Unlock()
+	}()
+
+	task()
+}
+
+// Returns an executor running each task in a tracked goroutine, as user code.
+func (group *goroutineGroup) executor() CallbackExecutor {
+	return groupExecutor{group: group}
+}
+
+func (group *goroutineGroup) closeGate() {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+
+	if !group.closed && group.closing != nil {
+		close(group.closing)
+		group.closing = nil
+	}
+	group.closed = true
+}
+
+// Returns false if Close() is waiting.
+func (group *goroutineGroup) openGate() bool {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+
+	if group.waiting > 0 {
+		return false
+	}
+	group.closed = false
+	return true
+}
+
+// Returns a channel which is closed when the gate is closed, e.g. to stop the waiting before sending.
+func (group *goroutineGroup) closedChan() <-chan struct{} {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+
+	if group.closed {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	if group.closing == nil {
+		group.closing = make(chan struct{})
+	}
+	return group.closing
+}
+
+/*
+Same as time.AfterFunc(), but the task is tracked, and is run at once by fireTimers().
+Call the returned function to cancel the task.
+*/
+func (group *goroutineGroup) afterFunc(delay time.Duration, task func()) (stop func()) {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+
+	if group.timers == nil {
+		group.timers = make(map[*time.Timer]func())
+	}
+
+	group.running += 1
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		group.mutex.Lock()
+		delete(group.timers, timer)
+		group.mutex.Unlock()
+
+		group.run(task)
+	})
+	group.timers[timer] = task
+
+	return func() {
+		group.mutex.Lock()
+		defer group.mutex.Unlock()
+
+		if _, ok := group.timers[timer]; ok && timer.Stop() {
+			delete(group.timers, timer)
+			group.running -= 1
+			group.notify()
+		}
+	}
+}
+
+// Runs the tasks of the pending timers now, e.g. to fail the retrying quests when the client is closed.
+func (group *goroutineGroup) fireTimers() {
+	group.mutex.Lock()
+	var tasks []func()
+	for timer, task := range group.timers {
+		if timer.Stop() {
+			tasks = append(tasks, task)
+		}
+		delete(group.timers, timer)
+	}
+	group.mutex.Unlock()
+
+	//-- The stopped timers are still counted in running.
+	for _, task := range tasks {
+		go group.run(task)
+	}
+}
+
+/*
+Waits for all tracked goroutines to exit.
+If it is called in user code run by call(), e.g. Close() is called in a quest handler, the goroutines running
+user code are not waited, including the current one. They exit after they return from the user code.
+*/
+func (group *goroutineGroup) wait() {
+	inUserCode := isInUserCode()
+
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+
+	if group.changed == nil {
+		group.changed = sync.NewCond(&group.mutex)
+	}
+
+	group.waiting += 1
+	for group.running > 0 && !(inUserCode && group.running == group.calling) {
+		group.changed.Wait()
+	}
+	group.waiting -= 1
+}
+
+var groupCallFunc = runtime.FuncForPC(reflect.ValueOf((*goroutineGroup).call).Pointer()).Name()
+
+// Whether the current goroutine is running user code, i.e. goroutineGroup.call() is on the stack.
+func isInUserCode() bool {
+	pcs := make([]uintptr, 64)
+	for {
+		n := runtime.Callers(2, pcs)
+		if n < len(pcs) {
+			pcs = pcs[:n]
+			break
+		}
+		pcs = make([]uintptr, 2*len(pcs))
+	}
+
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if frame.Function == groupCallFunc {
+			return true
+		}
+		if !more {
+			return false
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package fpnn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/highras/fpnn-sdk-go/src/fpnn/fpnntest"
+)
+
+func TestNoGoroutineLeaksAfterClose(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+	defer fpnntest.CheckGoroutineLeaks(t)()
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetOfflineQueue(8, OfflineQueueRejectNew)
+	client.SetKeepAlive(true)
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+	if _, err := client.SendQuest(NewQuest("echo")); err != nil {
+		t.Fatalf("send quest failed, err: %v", err)
+	}
+
+	server.dropConnections()
+	time.Sleep(100 * time.Millisecond)
+
+	client.Close()
+}
+
+func TestCloseDialingClient(t *testing.T) {
+	defer fpnntest.CheckGoroutineLeaks(t)()
+
+	//-- Non-routable address, the dialing blocks until the connect timeout.
+	client := NewTCPClient("10.255.255.1:13011")
+	client.SetLogger(testLogger)
+	client.SetConnectTimeOut(10 * time.Second)
+
+	done := make(chan bool, 1)
+	go func() {
+		done <- client.Connect()
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	client.Close()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("connect is not cancelled by close")
+	}
+}
+
+type closingProcessor struct {
+	client *TCPClient
+}
+
+func (processor *closingProcessor) Process(method string) func(*Quest) (*Answer, error) {
+	return func(quest *Quest) (*Answer, error) {
+		processor.client.Close()
+		return nil, nil
+	}
+}
+
+func TestCloseInQuestHandler(t *testing.T) {
+	for _, workers := range []int{0, 2} {
+		server := newTestServer(t, echoHandler)
+
+		client := NewTCPClient(server.endpoint())
+		client.SetLogger(testLogger)
+		client.SetQuestProcessor(&closingProcessor{client: client})
+		client.SetQuestWorkerPool(workers, 4, QuestPoolFullBlock)
+
+		if !client.Connect() {
+			t.Fatalf("connect failed")
+		}
+
+		closed := make(chan struct{})
+		client.SetOnClosedCallback(func(connId uint64, endpoint string) {
+			close(closed)
+		})
+
+		server.pushQuest(t, NewOneWayQuest("close"))
+
+		select {
+		case <-closed:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("client is not closed in the quest handler, workers: %d", workers)
+		}
+	}
+}
+
+func TestCloseWaitsForRunningHandler(t *testing.T) {
+	for _, workers := range []int{0, 2} {
+		server := newTestServer(t, echoHandler)
+		checkLeaks := fpnntest.CheckGoroutineLeaks(t)
+
+		processor := &blockingProcessor{release: make(chan struct{}), started: make(chan struct{}, 1)}
+		client := NewTCPClient(server.endpoint())
+		client.SetLogger(testLogger)
+		client.SetQuestProcessor(processor)
+		client.SetQuestWorkerPool(workers, 4, QuestPoolFullBlock)
+
+		if !client.Connect() {
+			t.Fatalf("connect failed")
+		}
+
+		server.pushQuest(t, NewOneWayQuest("slow"))
+		select {
+		case <-processor.started:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("quest handler is not started, workers: %d", workers)
+		}
+
+		closed := make(chan struct{})
+		go func() {
+			client.Close()
+			close(closed)
+		}()
+
+		select {
+		case <-closed:
+			t.Fatalf("close returns while the quest handler is running, workers: %d", workers)
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		close(processor.release)
+		select {
+		case <-closed:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("close is not returned after the quest handler returns, workers: %d", workers)
+		}
+		checkLeaks()
+	}
+}
+
+func TestCloseWaitsForReplacedConnections(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+	defer fpnntest.CheckGoroutineLeaks(t)()
+
+	release := make(chan struct{})
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetOnClosedCallback(func(connId uint64, endpoint string) {
+		<-release
+	})
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	//-- The callback of the dropped connection is still running after reconnecting.
+	server.dropConnections()
+	time.Sleep(100 * time.Millisecond)
+	if !client.Connect() {
+		t.Fatalf("reconnect failed")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		client.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		t.Fatalf("close returns while the closed callback of the replaced connection is running")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("close is not returned after the callbacks return")
+	}
+}
+
+func TestCloseInInlineCallback(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetCallbackExecutor(NewInlineCallbackExecutor())
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	closed := make(chan struct{})
+	client.SendQuestWithLambda(NewQuest("echo"), func(answer *Answer, errorCode int) {
+		client.Close()
+		close(closed)
+	})
+
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("client is not closed in the inline callback")
+	}
+}
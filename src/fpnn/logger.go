@@ -1,6 +1,154 @@
 package fpnn
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 type Logger interface {
 	Println(...any)
 	Printf(string, ...any)
 }
+
+/*
+LeveledLogger is compatible with *slog.Logger of log/slog.
+args are alternating keys and values, such as "method", "demo", "seqNum", 12.
+*/
+type LeveledLogger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+func (level LogLevel) String() string {
+	switch level {
+	case LogLevelDebug:
+		return "DEBUG"
+	case LogLevelInfo:
+		return "INFO"
+	case LogLevelWarn:
+		return "WARN"
+	case LogLevelError:
+		return "ERROR"
+	}
+	return "LEVEL(" + strconv.Itoa(int(level)) + ")"
+}
+
+type printfLeveledLogger struct {
+	logger   Logger
+	minLevel LogLevel
+}
+
+/*
+Adapts Logger to LeveledLogger. Messages below minLevel are dropped, and others are printed as:
+
+	[ERROR] Decode answer failed. endpoint=127.0.0.1:13609 connId=1 err="unexpected EOF"
+*/
+func NewLeveledLogger(logger Logger, minLevel LogLevel) LeveledLogger {
+	return &printfLeveledLogger{logger: logger, minLevel: minLevel}
+}
+
+func (logger *printfLeveledLogger) Debug(msg string, args ...any) {
+	logger.log(LogLevelDebug, msg, args)
+}
+
+func (logger *printfLeveledLogger) Info(msg string, args ...any) {
+	logger.log(LogLevelInfo, msg, args)
+}
+
+func (logger *printfLeveledLogger) Warn(msg string, args ...any) {
+	logger.log(LogLevelWarn, msg, args)
+}
+
+func (logger *printfLeveledLogger) Error(msg string, args ...any) {
+	logger.log(LogLevelError, msg, args)
+}
+
+func (logger *printfLeveledLogger) log(level LogLevel, msg string, args []any) {
+	if level < logger.minLevel {
+		return
+	}
+
+	var builder strings.Builder
+	builder.WriteString("[" + level.String() + "] " + msg)
+
+	for i := 0; i < len(args); i += 2 {
+		builder.WriteByte(' ')
+		if i+1 == len(args) {
+			builder.WriteString("!BADKEY=" + formatLogValue(args[i]))
+			break
+		}
+
+		builder.WriteString(fmt.Sprint(args[i]) + "=" + formatLogValue(args[i+1]))
+	}
+
+	logger.logger.Println(builder.String())
+}
+
+func formatLogValue(value any) string {
+	text := fmt.Sprint(value)
+	if text == "" || strings.ContainsAny(text, " \t\n\"=") {
+		return strconv.Quote(text)
+	}
+	return text
+}
+
+//-----------------[ tcpConnection logging ]-----------------//
+
+func (conn *tcpConnection) logFields(args []any) []any {
+	return append([]any{"endpoint", conn.endpoint, "connId", conn.connId}, args...)
+}
+
+func (conn *tcpConnection) logDebug(msg string, args ...any) {
+	conn.logger.Debug(msg, conn.logFields(args)...)
+}
+
+func (conn *tcpConnection) logWarn(msg string, args ...any) {
+	conn.logger.Warn(msg, conn.logFields(args)...)
+}
+
+func (conn *tcpConnection) logError(msg string, args ...any) {
+	conn.logger.Error(msg, conn.logFields(args)...)
+}
+
+//-----------------[ TCPClient logging ]-----------------//
+
+/*
+The leveled logger takes precedence over the logger set by SetLogger().
+*/
+func (client *TCPClient) SetLeveledLogger(logger LeveledLogger) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.leveledLogger = logger
+}
+
+// Without leveled logger, the Logger is adapted with LogLevelInfo.
+func (client *TCPClient) activeLeveledLogger() LeveledLogger {
+	client.mutex.Lock()
+	logger := client.leveledLogger
+	client.mutex.Unlock()
+
+	if logger != nil {
+		return logger
+	}
+	return NewLeveledLogger(client.activeLogger(), LogLevelInfo)
+}
+
+func toLeveledLogger(logger Logger) LeveledLogger {
+	if leveled, ok := logger.(LeveledLogger); ok {
+		return leveled
+	}
+	return NewLeveledLogger(logger, LogLevelDebug)
+}
@@ -0,0 +1,99 @@
+package fpnn
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingLogger struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+func (logger *recordingLogger) Println(args ...any) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	logger.lines = append(logger.lines, strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+}
+
+func (logger *recordingLogger) Printf(format string, args ...any) {
+	logger.Println(fmt.Sprintf(format, args...))
+}
+
+func (logger *recordingLogger) find(prefix string) (string, bool) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	for _, line := range logger.lines {
+		if strings.HasPrefix(line, prefix) {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+func TestLeveledLoggerAdapter(t *testing.T) {
+	output := &recordingLogger{}
+	logger := NewLeveledLogger(output, LogLevelWarn)
+
+	logger.Info("Dropped.")
+	logger.Warn("Received invalid answer.", "seqNum", 12, "ex", "not found", "empty", "")
+	logger.Error("Bad args.", "err")
+
+	expected := []string{
+		`[WARN] Received invalid answer. seqNum=12 ex="not found" empty=""`,
+		`[ERROR] Bad args. !BADKEY=err`,
+	}
+	if strings.Join(output.lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected output:\n%s", strings.Join(output.lines, "\n"))
+	}
+}
+
+func TestClientLeveledLogger(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	output := &recordingLogger{}
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetLeveledLogger(NewLeveledLogger(output, LogLevelDebug))
+	defer client.Close()
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	quest := NewQuest("unknown")
+	quest.seqNum = 777
+	binData, err := NewAnswer(quest).Raw()
+	if err != nil {
+		t.Fatalf("encode answer failed, err: %v", err)
+	}
+
+	server.mutex.Lock()
+	for conn, writeMutex := range server.conns {
+		writeMutex.Lock()
+		conn.Write(binData)
+		writeMutex.Unlock()
+	}
+	server.mutex.Unlock()
+
+	prefix := "[DEBUG] Received invalid answer. endpoint=" + server.endpoint() + " connId="
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if line, ok := output.find(prefix); ok {
+			if !strings.HasSuffix(line, " seqNum=777") {
+				t.Fatalf("unexpected log: %s", line)
+			}
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("invalid answer is not logged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
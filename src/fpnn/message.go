@@ -2,10 +2,9 @@ package fpnn
 
 import (
 	"fmt"
-	"bytes"
 	"errors"
+	"context"
 	"encoding/binary"
-	"github.com/ugorji/go/codec"
 )
 
 type Quest struct {
@@ -13,6 +12,11 @@ type Quest struct {
 	method string
 	isTwoWay bool
 	isMsgPack bool
+	conn *tcpConnection
+	responder *QuestResponder
+	answerSent func(answer *Answer)
+	handle *QuestHandle
+	ctx context.Context
 	Payload
 }
 
@@ -56,16 +60,10 @@ func NewOneWayQuestWithPayload(method string, payload *Payload) *Quest {
 func NewQuestWithRawData(data *rawData) (*Quest, error) {
 	quest := &Quest{}
 
-	var handle codec.Handle
 	if (data.header[5] & FlagMsgpack) == FlagMsgpack {
 		quest.isMsgPack = true
-
-		var mh codec.MsgpackHandle
-		mh.RawToString = true
-		handle = &mh
 	} else if (data.header[5] & FlagJson) == FlagJson {
 		quest.isMsgPack = false
-		handle = new(codec.JsonHandle)
 	} else {
 		return nil, errors.New("Invalid FPNN package flag")
 	}
@@ -84,8 +82,7 @@ func NewQuestWithRawData(data *rawData) (*Quest, error) {
 	case MessageTypeTwoWay:
 		quest.isTwoWay = true
 
-		seqNumReader := bytes.NewReader(data.body[:4])
-		binary.Read(seqNumReader, binary.LittleEndian, &quest.seqNum)
+		quest.seqNum = binary.LittleEndian.Uint32(data.body[:4])
 
 		methodSlice = data.body[4:4 + methodLen]
 		payloadSlice = data.body[4 + methodLen:]
@@ -98,14 +95,39 @@ func NewQuestWithRawData(data *rawData) (*Quest, error) {
 	quest.method = string(methodSlice)
 	quest.Payload = Payload{}
 
-	decoder := codec.NewDecoderBytes(payloadSlice, handle)
-	if err := decoder.Decode(&quest.Payload.data); err != nil {
+	if err := decodePayload(quest.isMsgPack, payloadSlice, &quest.Payload.data); err != nil {
 		return nil, err
 	}
 
 	return quest, nil
 }
 
+func (quest *Quest) clone() *Quest {
+	dup := &Quest{}
+	dup.method = quest.method
+	dup.isTwoWay = quest.isTwoWay
+	dup.isMsgPack = quest.isMsgPack
+	dup.handle = quest.handle
+	dup.ctx = quest.ctx
+	dup.Payload = quest.Payload
+	return dup
+}
+
+/*
+For incoming quests, the context carries the trace context extracted by the tracer of the client.
+For outgoing quests, the context is the parent of the client span. Returns context.Background() if unset.
+*/
+func (quest *Quest) Context() context.Context {
+	if quest.ctx == nil {
+		return context.Background()
+	}
+	return quest.ctx
+}
+
+func (quest *Quest) SetContext(ctx context.Context) {
+	quest.ctx = ctx
+}
+
 func (quest *Quest) IsOneWay() bool {
 	return !(quest.isTwoWay)
 }
@@ -131,20 +153,14 @@ func (quest *Quest) Method() string {
 }
 
 func (quest *Quest) Raw() ([]byte, error) {
-	var handle codec.Handle
 	header := [8]byte{
 		'F', 'P', 'N', 'N', ProtoVersion,
 	}
 
 	if quest.isMsgPack {
 		header[5] = FlagMsgpack
-
-		var mh codec.MsgpackHandle
-		mh.WriteExt = true
-		handle = &mh
 	} else {
 		header[5] = FlagJson
-		handle = new(codec.JsonHandle)
 	}
 
 	if quest.isTwoWay {
@@ -157,27 +173,32 @@ func (quest *Quest) Raw() ([]byte, error) {
 	header[7] = byte(uint8(len(quest.method)))
 	
 	//-----------------------------------------//
-	payloadBuf := new(bytes.Buffer)
-	encoder := codec.NewEncoder(payloadBuf, handle)
-	if err := encoder.Encode(quest.data); err != nil {
+	encoder := getPayloadEncoder(quest.isMsgPack)
+	defer putPayloadEncoder(quest.isMsgPack, encoder)
+
+	payload, err := encoder.encode(quest.data)
+	if err != nil {
 		return nil, err
 	}
-
-	payload := payloadBuf.Bytes()
-	payloadSize := uint32(len(payload))
 	//-----------------------------------------//
 
-	result := new(bytes.Buffer)
-	result.Write(header[:])
-	binary.Write(result, binary.LittleEndian, payloadSize)
+	size := 12 + len(quest.method) + len(payload)
+	if quest.isTwoWay {
+		size += 4
+	}
+
+	res := make([]byte, size)
+	copy(res, header[:])
+	binary.LittleEndian.PutUint32(res[8:], uint32(len(payload)))
+
+	pos := 12
 	if quest.isTwoWay {
-		binary.Write(result, binary.LittleEndian, quest.seqNum)
+		binary.LittleEndian.PutUint32(res[pos:], quest.seqNum)
+		pos += 4
 	}
-	result.WriteString(quest.method)
-	result.Write(payload)
+	pos += copy(res[pos:], quest.method)
+	copy(res[pos:], payload)
 
-	res := make([]byte, result.Len())
-	copy(res, result.Bytes())
 	return res, nil
 }
 
@@ -217,29 +238,21 @@ func newErrorAnswerWitSeqNum(seqNum uint32, code int, ex string) *Answer {
 func NewAnswerWithRawData(data *rawData) (*Answer, error) {
 	answer := &Answer{}
 
-	var handle codec.Handle
 	if (data.header[5] & FlagMsgpack) == FlagMsgpack {
 		answer.isMsgPack = true
-
-		var mh codec.MsgpackHandle
-		mh.RawToString = true
-		handle = &mh
 	} else if (data.header[5] & FlagJson) == FlagJson {
 		answer.isMsgPack = false
-		handle = new(codec.JsonHandle)
 	} else {
 		return nil, errors.New("Invalid FPNN package flag")
 	}
 
 	answer.status = uint8(data.header[7])
 
-	seqNumReader := bytes.NewReader(data.body[:4])
-	binary.Read(seqNumReader, binary.LittleEndian, &answer.seqNum)
+	answer.seqNum = binary.LittleEndian.Uint32(data.body[:4])
 
 	answer.Payload = Payload{}
 
-	decoder := codec.NewDecoderBytes(data.body[4:], handle)
-	if err := decoder.Decode(&answer.Payload.data); err != nil {
+	if err := decodePayload(answer.isMsgPack, data.body[4:], &answer.Payload.data); err != nil {
 		return nil, err
 	}
 
@@ -267,44 +280,35 @@ func (answer *Answer) IsJson() bool {
 }
 
 func (answer *Answer) Raw() ([]byte, error) {
-	var handle codec.Handle
 	header := [8]byte{
 		'F', 'P', 'N', 'N', ProtoVersion,
 	}
 
 	if answer.isMsgPack {
 		header[5] = FlagMsgpack
-
-		var mh codec.MsgpackHandle
-		mh.WriteExt = true
-		handle = &mh
 	} else {
 		header[5] = FlagJson
-		handle = new(codec.JsonHandle)
 	}
 
 	header[6] = MessageTypeAnswer
 	header[7] = byte(answer.status)
 	
 	//-----------------------------------------//
-	payloadBuf := new(bytes.Buffer)
-	encoder := codec.NewEncoder(payloadBuf, handle)
-	if err := encoder.Encode(answer.data); err != nil {
+	encoder := getPayloadEncoder(answer.isMsgPack)
+	defer putPayloadEncoder(answer.isMsgPack, encoder)
+
+	payload, err := encoder.encode(answer.data)
+	if err != nil {
 		return nil, err
 	}
-
-	payload := payloadBuf.Bytes()
-	payloadSize := uint32(len(payload))
 	//-----------------------------------------//
 
-	result := new(bytes.Buffer)
-	result.Write(header[:])
-	binary.Write(result, binary.LittleEndian, payloadSize)
-	binary.Write(result, binary.LittleEndian, answer.seqNum)
-	result.Write(payload)
+	res := make([]byte, 16 + len(payload))
+	copy(res, header[:])
+	binary.LittleEndian.PutUint32(res[8:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(res[12:], answer.seqNum)
+	copy(res[16:], payload)
 
-	res := make([]byte, result.Len())
-	copy(res, result.Bytes())
 	return res, nil
 }
 
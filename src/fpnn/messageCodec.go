@@ -0,0 +1,137 @@
+package fpnn
+
+import (
+	"sync"
+
+	"github.com/ugorji/go/codec"
+)
+
+// Codec handles are safe for concurrent use once configured, so they are shared by all messages.
+var (
+	msgpackEncodeHandle = newMsgpackHandle(false)
+	msgpackDecodeHandle = newMsgpackHandle(true)
+	jsonHandle          = &codec.JsonHandle{}
+)
+
+func newMsgpackHandle(decoding bool) *codec.MsgpackHandle {
+	handle := &codec.MsgpackHandle{}
+	if decoding {
+		handle.RawToString = true
+	} else {
+		handle.WriteExt = true
+	}
+	return handle
+}
+
+// Buffers larger than this are not returned to the pools, to avoid pinning memory after a huge message.
+const maxPooledBufferSize = 64 * 1024
+
+//-----------------[ payload encoder ]-----------------//
+
+type payloadEncoder struct {
+	encoder *codec.Encoder
+	buffer  []byte
+}
+
+func newPayloadEncoderPool(handle codec.Handle) *sync.Pool {
+	return &sync.Pool{
+		New: func() interface{} {
+			enc := &payloadEncoder{buffer: make([]byte, 0, 256)}
+			enc.encoder = codec.NewEncoderBytes(&enc.buffer, handle)
+			return enc
+		},
+	}
+}
+
+var (
+	msgpackEncoderPool = newPayloadEncoderPool(msgpackEncodeHandle)
+	jsonEncoderPool    = newPayloadEncoderPool(jsonHandle)
+)
+
+func getPayloadEncoder(isMsgPack bool) *payloadEncoder {
+	if isMsgPack {
+		return msgpackEncoderPool.Get().(*payloadEncoder)
+	}
+	return jsonEncoderPool.Get().(*payloadEncoder)
+}
+
+func putPayloadEncoder(isMsgPack bool, enc *payloadEncoder) {
+	if cap(enc.buffer) > maxPooledBufferSize {
+		return
+	}
+
+	if isMsgPack {
+		msgpackEncoderPool.Put(enc)
+	} else {
+		jsonEncoderPool.Put(enc)
+	}
+}
+
+// The returned slice is owned by the encoder, and is only valid before the encoder is put back.
+func (enc *payloadEncoder) encode(data interface{}) ([]byte, error) {
+	enc.encoder.ResetBytes(&enc.buffer)
+	if err := enc.encoder.Encode(data); err != nil {
+		return nil, err
+	}
+	return enc.buffer, nil
+}
+
+//-----------------[ payload decoder ]-----------------//
+
+func newPayloadDecoderPool(handle codec.Handle) *sync.Pool {
+	return &sync.Pool{
+		New: func() interface{} {
+			return codec.NewDecoderBytes(nil, handle)
+		},
+	}
+}
+
+var (
+	msgpackDecoderPool = newPayloadDecoderPool(msgpackDecodeHandle)
+	jsonDecoderPool    = newPayloadDecoderPool(jsonHandle)
+)
+
+// Decoded strings and bytes are copied, so the payload buffer can be reused after decoding.
+func decodePayload(isMsgPack bool, payload []byte, data *map[interface{}]interface{}) error {
+	pool := jsonDecoderPool
+	if isMsgPack {
+		pool = msgpackDecoderPool
+	}
+
+	decoder := pool.Get().(*codec.Decoder)
+	decoder.ResetBytes(payload)
+	err := decoder.Decode(data)
+	decoder.ResetBytes(nil)
+	pool.Put(decoder)
+
+	return err
+}
+
+//-----------------[ body buffer ]-----------------//
+
+var bodyBufferPool = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, 0, 1024)
+		return &buffer
+	},
+}
+
+func (data *rawData) allocBody(size int) {
+	buffer := bodyBufferPool.Get().(*[]byte)
+	if cap(*buffer) < size {
+		*buffer = make([]byte, size)
+	}
+
+	data.buffer = buffer
+	data.body = (*buffer)[:size]
+}
+
+// Must be called only after the quest or answer has been decoded from the body.
+func (data *rawData) release() {
+	if data.buffer != nil && cap(*data.buffer) <= maxPooledBufferSize {
+		bodyBufferPool.Put(data.buffer)
+	}
+
+	data.buffer = nil
+	data.body = nil
+}
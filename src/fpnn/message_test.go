@@ -0,0 +1,192 @@
+package fpnn
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func newBenchmarkQuest() *Quest {
+	quest := NewQuest("benchmark")
+	quest.Param("uid", 123456)
+	quest.Param("name", "fpnn benchmark")
+	quest.Param("tags", []string{"a", "b", "c"})
+	quest.Param("data", []byte{1, 2, 3, 4})
+	quest.seqNum = 1
+	return quest
+}
+
+func splitRawData(t testing.TB, frame []byte) *rawData {
+	data := newRawData()
+	if err := readRawData(bytes.NewReader(frame), data, nil, Config.maxPayloadSize); err != nil {
+		t.Fatalf("read raw data failed")
+	}
+	return data
+}
+
+func TestQuestRawRoundTrip(t *testing.T) {
+	for _, isMsgPack := range []bool{true, false} {
+		for _, isTwoWay := range []bool{true, false} {
+			quest := newBenchmarkQuest()
+			quest.isMsgPack = isMsgPack
+			quest.isTwoWay = isTwoWay
+
+			frame, err := quest.Raw()
+			if err != nil {
+				t.Fatalf("encode quest failed: %v", err)
+			}
+
+			data := splitRawData(t, frame)
+			decoded, err := NewQuestWithRawData(data)
+			data.release()
+			if err != nil {
+				t.Fatalf("decode quest failed: %v", err)
+			}
+
+			if decoded.Method() != "benchmark" || decoded.IsTwoWay() != isTwoWay || decoded.IsMsgPack() != isMsgPack {
+				t.Fatalf("quest header mismatch: %+v", decoded)
+			}
+			if isTwoWay && decoded.SeqNum() != 1 {
+				t.Fatalf("seqNum mismatch: %d", decoded.SeqNum())
+			}
+			if name, _ := decoded.GetString("name"); name != "fpnn benchmark" {
+				t.Fatalf("payload mismatch: %v", decoded.data)
+			}
+		}
+	}
+}
+
+func TestAnswerRawRoundTripWithReusedBuffers(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+
+			for j := 0; j < 200; j++ {
+				answer := NewAnswer(newBenchmarkQuest())
+				answer.seqNum = uint32(idx*1000 + j)
+				answer.Param("result", "ok")
+
+				frame, err := answer.Raw()
+				if err != nil {
+					t.Errorf("encode answer failed: %v", err)
+					return
+				}
+
+				data := splitRawData(t, frame)
+				decoded, err := NewAnswerWithRawData(data)
+				data.release()
+				if err != nil {
+					t.Errorf("decode answer failed: %v", err)
+					return
+				}
+
+				if result, _ := decoded.GetString("result"); result != "ok" || decoded.SeqNum() != answer.seqNum {
+					t.Errorf("answer mismatch: %d %v", decoded.SeqNum(), decoded.data)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestReadRawDataDecryptsInPlace(t *testing.T) {
+	secret := bytes.Repeat([]byte{7}, 32)
+	encoder := newEncryptor(secret, 128)
+	decoder := newEncryptor(secret, 128)
+
+	var stream []byte
+	var frames [][]byte
+	for i := 0; i < 3; i++ {
+		quest := newBenchmarkQuest()
+		quest.seqNum = uint32(i + 1)
+
+		frame, _ := quest.Raw()
+		frames = append(frames, frame)
+		stream = append(stream, encoder.encrypt(frame)...)
+	}
+
+	reader := bytes.NewReader(stream)
+	data := newRawData()
+	for i, frame := range frames {
+		if err := readRawData(reader, data, decoder, Config.maxPayloadSize); err != nil {
+			t.Fatalf("read frame %d failed", i)
+		}
+		if !bytes.Equal(data.header, frame[:12]) || !bytes.Equal(data.body, frame[12:]) {
+			t.Fatalf("frame %d mismatch", i)
+		}
+		data.release()
+	}
+}
+
+func BenchmarkQuestRaw(b *testing.B) {
+	quest := newBenchmarkQuest()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := quest.Raw(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAnswerRaw(b *testing.B) {
+	answer := NewAnswer(newBenchmarkQuest())
+	answer.Param("result", "ok")
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := answer.Raw(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadAndDecodeQuest(b *testing.B) {
+	frame, _ := newBenchmarkQuest().Raw()
+	reader := bytes.NewReader(frame)
+	data := newRawData()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		reader.Reset(frame)
+		if err := readRawData(reader, data, nil, Config.maxPayloadSize); err != nil {
+			b.Fatal("read raw data failed")
+		}
+		if _, err := NewQuestWithRawData(data); err != nil {
+			b.Fatal(err)
+		}
+		data.release()
+	}
+}
+
+func BenchmarkReadAndDecodeEncryptedAnswer(b *testing.B) {
+	answer := NewAnswer(newBenchmarkQuest())
+	answer.Param("result", "ok")
+	frame, _ := answer.Raw()
+
+	secret := bytes.Repeat([]byte{7}, 32)
+	encoder := newEncryptor(secret, 256)
+	decoder := newEncryptor(secret, 256)
+
+	encrypted := make([]byte, len(frame))
+	reader := bytes.NewReader(encrypted)
+	data := newRawData()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		copy(encrypted, frame)
+		encoder.encryptInPlace(encrypted)
+		reader.Reset(encrypted)
+
+		if err := readRawData(reader, data, decoder, Config.maxPayloadSize); err != nil {
+			b.Fatal("read raw data failed")
+		}
+		if _, err := NewAnswerWithRawData(data); err != nil {
+			b.Fatal(err)
+		}
+		data.release()
+	}
+}
@@ -0,0 +1,148 @@
+package fpnn
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+/*
+MetricsSink receives the metrics of clients. It must be safe for concurrent use.
+Every metric is labeled with "endpoint", and the metrics of quests are also labeled with "method".
+Gauges are also labeled with "client", so the clients to the same endpoint do not overwrite each other.
+*/
+type MetricsSink interface {
+	IncCounter(name string, labels map[string]string, delta float64)
+	SetGauge(name string, labels map[string]string, value float64)
+	ObserveHistogram(name string, labels map[string]string, value float64)
+}
+
+const (
+	//-- Counters
+	MetricQuestsSent     = "fpnn_client_quests_sent_total"
+	MetricQuestsAnswered = "fpnn_client_quests_answered_total" //-- labels: method, status ("ok" or "error")
+	MetricQuestsTimedOut = "fpnn_client_quests_timeout_total"
+	MetricQuestsFailed   = "fpnn_client_quests_failed_total"
+	MetricReconnects     = "fpnn_client_reconnects_total"
+	MetricHandshakes     = "fpnn_client_handshakes_total" //-- labels: type ("connect" or "key_exchange"), status ("ok" or "error")
+
+	//-- Gauges, labels: client
+	MetricInFlightQuests = "fpnn_client_in_flight_quests"
+	MetricConnected      = "fpnn_client_connected"
+
+	//-- Histograms, in seconds
+	MetricQuestLatency     = "fpnn_client_quest_latency_seconds"
+	MetricHandshakeLatency = "fpnn_client_handshake_latency_seconds" //-- labels: type
+)
+
+var lastClientId uint64
+
+// Identifies the client in the gauge labels.
+func nextClientId() uint64 {
+	return atomic.AddUint64(&lastClientId, 1)
+}
+
+type metricsTarget struct {
+	sink     MetricsSink
+	endpoint string
+	clientId string
+}
+
+func (stats *clientStats) setMetricsSink(sink MetricsSink, endpoint string) {
+	stats.target.Store(metricsTarget{sink: sink, endpoint: endpoint, clientId: strconv.FormatUint(stats.clientId, 10)})
+}
+
+func (stats *clientStats) metricsTarget() (metricsTarget, bool) {
+	if stats == nil {
+		return metricsTarget{}, false
+	}
+
+	target, _ := stats.target.Load().(metricsTarget)
+	return target, target.sink != nil
+}
+
+func (target metricsTarget) labels(keyValues ...string) map[string]string {
+	labels := make(map[string]string, len(keyValues)/2+1)
+	labels["endpoint"] = target.endpoint
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		labels[keyValues[i]] = keyValues[i+1]
+	}
+	return labels
+}
+
+func metricsStatus(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "error"
+}
+
+func (stats *clientStats) reportQuestSent(method string, twoWay bool) {
+	target, ok := stats.metricsTarget()
+	if !ok {
+		return
+	}
+
+	target.sink.IncCounter(MetricQuestsSent, target.labels("method", method), 1)
+	if twoWay {
+		target.sink.SetGauge(MetricInFlightQuests, target.labels("client", target.clientId), float64(atomic.LoadInt64(&stats.inFlight)))
+	}
+}
+
+func (stats *clientStats) reportQuestCompleted(cb *connCallback, errorCode int) {
+	target, ok := stats.metricsTarget()
+	if !ok {
+		return
+	}
+
+	labels := target.labels("method", cb.method)
+	switch errorCode {
+	case FPNN_EC_CORE_TIMEOUT:
+		target.sink.IncCounter(MetricQuestsTimedOut, labels, 1)
+	case FPNN_EC_CORE_CONNECTION_CLOSED, FPNN_EC_SDK_QUEST_CANCELLED:
+		target.sink.IncCounter(MetricQuestsFailed, labels, 1)
+	default:
+		target.sink.IncCounter(MetricQuestsAnswered, target.labels("method", cb.method, "status", metricsStatus(errorCode == FPNN_EC_OK)), 1)
+		if !cb.sentTime.IsZero() {
+			target.sink.ObserveHistogram(MetricQuestLatency, labels, time.Since(cb.sentTime).Seconds())
+		}
+	}
+
+	target.sink.SetGauge(MetricInFlightQuests, target.labels("client", target.clientId), float64(atomic.LoadInt64(&stats.inFlight)))
+}
+
+func (stats *clientStats) reportConnectionChanged(connected bool, connects int64) {
+	target, ok := stats.metricsTarget()
+	if !ok {
+		return
+	}
+
+	if connected {
+		if connects > 1 {
+			target.sink.IncCounter(MetricReconnects, target.labels(), 1)
+		}
+		target.sink.SetGauge(MetricConnected, target.labels("client", target.clientId), 1)
+	} else {
+		target.sink.SetGauge(MetricConnected, target.labels("client", target.clientId), 0)
+	}
+}
+
+func (stats *clientStats) reportHandshake(handshakeType string, succeeded bool, cost time.Duration) {
+	target, ok := stats.metricsTarget()
+	if !ok {
+		return
+	}
+
+	target.sink.IncCounter(MetricHandshakes, target.labels("type", handshakeType, "status", metricsStatus(succeeded)), 1)
+	target.sink.ObserveHistogram(MetricHandshakeLatency, target.labels("type", handshakeType), cost.Seconds())
+}
+
+//-----------------[ TCPClient metrics ]-----------------//
+
+/*
+The sink is called on every send, answer, timeout, reconnect and handshake of the client.
+Set nil to disable.
+*/
+func (client *TCPClient) SetMetricsSink(sink MetricsSink) {
+	client.stats.setMetricsSink(sink, client.endpoint)
+}
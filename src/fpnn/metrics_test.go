@@ -0,0 +1,110 @@
+package fpnn
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusSinkExposition(t *testing.T) {
+	sink := NewPrometheusSink(0.1, 1)
+	sink.IncCounter("requests_total", map[string]string{"method": `a"b`}, 2)
+	sink.IncCounter("requests_total", map[string]string{"method": `a"b`}, 1)
+	sink.SetGauge("connected", nil, 1)
+	sink.ObserveHistogram("latency_seconds", map[string]string{"method": "m"}, 0.05)
+	sink.ObserveHistogram("latency_seconds", map[string]string{"method": "m"}, 0.5)
+	sink.ObserveHistogram("latency_seconds", map[string]string{"method": "m"}, 3)
+
+	//-- Different kind with the same name is ignored.
+	sink.SetGauge("requests_total", nil, 10)
+
+	recorder := httptest.NewRecorder()
+	sink.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	expected := `# TYPE connected gauge
+connected 1
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="m",le="0.1"} 1
+latency_seconds_bucket{method="m",le="1"} 2
+latency_seconds_bucket{method="m",le="+Inf"} 3
+latency_seconds_sum{method="m"} 3.55
+latency_seconds_count{method="m"} 3
+# TYPE requests_total counter
+requests_total{method="a\"b"} 3
+`
+	if body := recorder.Body.String(); body != expected {
+		t.Fatalf("unexpected exposition:\n%s", body)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type: %s", contentType)
+	}
+}
+
+func TestClientMetricsSink(t *testing.T) {
+	server := newTestServer(t, func(quest *Quest) *Answer {
+		if quest.Method() == "silent" {
+			return nil
+		}
+		return echoHandler(quest)
+	})
+
+	sink := NewPrometheusSink()
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetMetricsSink(sink)
+	defer client.Close()
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	if _, err := client.SendQuest(NewQuest("echo")); err != nil {
+		t.Fatalf("send quest failed, err: %v", err)
+	}
+	client.SendQuest(NewQuest("silent"), time.Second)
+
+	server.dropConnections()
+	deadline := time.Now().Add(3 * time.Second)
+	for client.IsConnected() {
+		if time.Now().After(deadline) {
+			t.Fatalf("connection is not closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !client.Connect() {
+		t.Fatalf("reconnect failed")
+	}
+
+	//-- Another client to the same endpoint adds to the counters, but does not overwrite the gauges of the client.
+	other := NewTCPClient(server.endpoint())
+	other.SetLogger(testLogger)
+	other.SetMetricsSink(sink)
+	defer other.Close()
+
+	if err := other.SendQuestWithLambda(NewQuest("silent"), func(*Answer, int) {}); err != nil {
+		t.Fatalf("send quest failed, err: %v", err)
+	}
+
+	body := string(sink.render())
+	endpoint := `endpoint="` + server.endpoint() + `"`
+	client1 := `client="` + strconv.FormatUint(client.stats.clientId, 10) + `",` + endpoint
+	client2 := `client="` + strconv.FormatUint(other.stats.clientId, 10) + `",` + endpoint
+	for _, line := range []string{
+		`fpnn_client_quests_sent_total{` + endpoint + `,method="echo"} 1`,
+		`fpnn_client_quests_answered_total{` + endpoint + `,method="echo",status="ok"} 1`,
+		`fpnn_client_quest_latency_seconds_count{` + endpoint + `,method="echo"} 1`,
+		`fpnn_client_quests_timeout_total{` + endpoint + `,method="silent"} 1`,
+		`fpnn_client_reconnects_total{` + endpoint + `} 1`,
+		`fpnn_client_handshakes_total{` + endpoint + `,status="ok",type="connect"} 3`,
+		`fpnn_client_connected{` + client1 + `} 1`,
+		`fpnn_client_in_flight_quests{` + client1 + `} 0`,
+		`fpnn_client_in_flight_quests{` + client2 + `} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("missing %s in:\n%s", line, body)
+		}
+	}
+}
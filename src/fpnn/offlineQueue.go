@@ -0,0 +1,268 @@
+package fpnn
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+type OfflineQueueFullPolicy int
+
+const (
+	OfflineQueueRejectNew OfflineQueueFullPolicy = iota
+	OfflineQueueDropOldest
+)
+
+var ErrOfflineQueueFull = errors.New("Offline queue is full.")
+
+const offlineQueueExpireInterval = 200 * time.Millisecond
+
+type offlineQuest struct {
+	quest    *Quest
+	callback *connCallback
+	deadline time.Time
+}
+
+type offlineQueue struct {
+	mutex      sync.Mutex
+	maxSize    int
+	fullPolicy OfflineQueueFullPolicy
+	quests     []*offlineQuest
+	expiring   bool
+	executor   CallbackExecutor
+	routines   *goroutineGroup
+}
+
+func (queue *offlineQueue) config(maxSize int, fullPolicy OfflineQueueFullPolicy) {
+	queue.mutex.Lock()
+	queue.maxSize = maxSize
+	queue.fullPolicy = fullPolicy
+	queue.mutex.Unlock()
+
+	if maxSize <= 0 {
+		queue.failAll(FPNN_EC_CORE_CONNECTION_CLOSED, "Offline queue is disabled.")
+	}
+}
+
+func (queue *offlineQueue) setExecutor(executor CallbackExecutor) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.executor = executor
+}
+
+func (queue *offlineQueue) enabled() bool {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	return queue.maxSize > 0
+}
+
+// Returns the quest dropped by OfflineQueueDropOldest, and whether the expire loop should be started.
+func (queue *offlineQueue) push(item *offlineQuest) (dropped *offlineQuest, startExpiring bool, err error) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if len(queue.quests) >= queue.maxSize {
+		if queue.fullPolicy != OfflineQueueDropOldest || len(queue.quests) == 0 {
+			return nil, false, ErrOfflineQueueFull
+		}
+
+		dropped = queue.quests[0]
+		queue.quests[0] = nil
+		queue.quests = queue.quests[1:]
+	}
+
+	queue.quests = append(queue.quests, item)
+
+	if !queue.expiring {
+		queue.expiring = true
+		startExpiring = true
+	}
+	return
+}
+
+func (queue *offlineQueue) popAll() []*offlineQuest {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	quests := queue.quests
+	queue.quests = nil
+	return quests
+}
+
+func (queue *offlineQueue) pushFront(quests []*offlineQuest) (startExpiring bool) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.quests = append(quests, queue.quests...)
+
+	if !queue.expiring {
+		queue.expiring = true
+		startExpiring = true
+	}
+	return
+}
+
+func (queue *offlineQueue) remove(quest *Quest) *offlineQuest {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	for idx, item := range queue.quests {
+		if item.quest == quest {
+			copy(queue.quests[idx:], queue.quests[idx+1:])
+			queue.quests[len(queue.quests)-1] = nil
+			queue.quests = queue.quests[:len(queue.quests)-1]
+			return item
+		}
+	}
+	return nil
+}
+
+func (queue *offlineQueue) popExpired(now time.Time) (expired []*offlineQuest, empty bool) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	remained := queue.quests[:0]
+	for _, item := range queue.quests {
+		if !now.Before(item.deadline) {
+			expired = append(expired, item)
+		} else {
+			remained = append(remained, item)
+		}
+	}
+
+	for i := len(remained); i < len(queue.quests); i++ {
+		queue.quests[i] = nil
+	}
+	queue.quests = remained
+
+	if len(queue.quests) == 0 {
+		queue.expiring = false
+		return expired, true
+	}
+	return expired, false
+}
+
+func (queue *offlineQueue) expireLoop() {
+	ticker := time.NewTicker(offlineQueueExpireInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		expired, empty := queue.popExpired(now)
+		for _, item := range expired {
+			queue.fail(item, FPNN_EC_CORE_TIMEOUT, "Quest is timeout.")
+		}
+
+		if empty {
+			return
+		}
+	}
+}
+
+func (queue *offlineQueue) failAll(errorCode int, ex string) {
+	for _, item := range queue.popAll() {
+		queue.fail(item, errorCode, ex)
+	}
+}
+
+func (queue *offlineQueue) fail(item *offlineQuest, errorCode int, ex string) {
+	if item.callback == nil {
+		return
+	}
+
+	queue.mutex.Lock()
+	executor := queue.executor
+	queue.mutex.Unlock()
+
+	if executor == nil {
+		executor = queue.routines.executor()
+	}
+
+	answer := newErrorAnswerWitSeqNum(item.quest.seqNum, errorCode, ex)
+	executeAnswerCallback(executor, answer, item.callback)
+}
+
+//-----------------[ TCPClient offline queue ]-----------------//
+
+/*
+Quests sent while the connection is lost are held in a bounded queue if maxSize > 0,
+and are flushed after the client reconnected. Requires auto reconnection.
+*/
+func (client *TCPClient) SetOfflineQueue(maxSize int, fullPolicy OfflineQueueFullPolicy) {
+	client.offlineQueue.config(maxSize, fullPolicy)
+}
+
+func (client *TCPClient) startOfflineExpiring() {
+	client.routines.start(func() {
+		client.offlineQueue.expireLoop()
+	})
+}
+
+func (client *TCPClient) enqueueOfflineQuest(quest *Quest, cb *connCallback) error {
+
+	item := &offlineQuest{quest: quest, callback: cb}
+	if cb != nil {
+		item.deadline = cb.deadline
+	} else {
+		item.deadline = time.Now().Add(client.defaultQuestTimeout())
+	}
+
+	dropped, startExpiring, err := client.offlineQueue.push(item)
+	if err != nil {
+		return err
+	}
+
+	if dropped != nil {
+		client.offlineQueue.fail(dropped, FPNN_EC_CORE_WORK_QUEUE_FULL, "Offline queue is full.")
+	}
+
+	if startExpiring {
+		client.startOfflineExpiring()
+	}
+
+	if quest.handle != nil {
+		quest.handle.track(func() {
+			if item := client.offlineQueue.remove(quest); item != nil {
+				client.offlineQueue.fail(item, FPNN_EC_SDK_QUEST_CANCELLED, "Quest is cancelled.")
+			}
+		})
+	}
+
+	client.startReconnectLoop()
+	return nil
+}
+
+func (client *TCPClient) flushOfflineQueue(conn *tcpConnection) {
+
+	quests := client.offlineQueue.popAll()
+	now := time.Now()
+
+	if client.isShuttingDown() {
+		for _, item := range quests {
+			client.offlineQueue.fail(item, FPNN_EC_CORE_CONNECTION_CLOSED, "Client is shutting down.")
+		}
+		return
+	}
+
+	for idx, item := range quests {
+		if !now.Before(item.deadline) {
+			client.offlineQueue.fail(item, FPNN_EC_CORE_TIMEOUT, "Quest is timeout.")
+			continue
+		}
+
+		if err := conn.sendQuest(item.quest, item.callback); err != nil {
+			//-- Errors of the quest itself, such as encoding failure, fail the quest only.
+			if conn.isConnected() {
+				client.offlineQueue.fail(item, FPNN_EC_CORE_SEND_ERROR, err.Error())
+				continue
+			}
+
+			if client.offlineQueue.pushFront(quests[idx:]) {
+				client.startOfflineExpiring()
+			}
+			client.startReconnectLoop()
+			return
+		}
+	}
+}
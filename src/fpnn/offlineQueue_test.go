@@ -0,0 +1,106 @@
+package fpnn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOfflineQueueFlushAfterReconnect(t *testing.T) {
+	endpoint := closedEndpoint(t)
+
+	client := NewTCPClient(endpoint)
+	client.SetLogger(testLogger)
+	client.SetReconnectPolicy(&ReconnectPolicy{InitialDelay: 20 * time.Millisecond, MaxDelay: 50 * time.Millisecond})
+	client.SetOfflineQueue(10, OfflineQueueRejectNew)
+	defer client.Close()
+
+	codeChan := make(chan int, 1)
+	quest := NewQuest("echo")
+	quest.Param("key", "value")
+	err := client.SendQuestWithLambda(quest, func(answer *Answer, errorCode int) {
+		codeChan <- errorCode
+	}, 5*time.Second)
+	if err != nil {
+		t.Fatalf("quest should be queued, err: %v", err)
+	}
+
+	newTestServerAt(t, endpoint, echoHandler)
+
+	select {
+	case code := <-codeChan:
+		if code != FPNN_EC_OK {
+			t.Fatalf("queued quest failed, errorCode: %d", code)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("queued quest was not flushed")
+	}
+}
+
+func TestOfflineQueueFlushFailsBadQuestOnly(t *testing.T) {
+	endpoint := closedEndpoint(t)
+
+	client := NewTCPClient(endpoint)
+	client.SetLogger(testLogger)
+	client.SetReconnectPolicy(&ReconnectPolicy{InitialDelay: 20 * time.Millisecond, MaxDelay: 50 * time.Millisecond})
+	client.SetOfflineQueue(10, OfflineQueueRejectNew)
+	defer client.Close()
+
+	badChan := make(chan int, 1)
+	bad := NewQuest("echo")
+	bad.Param("key", complex(1, 2))
+	if err := client.SendQuestWithLambda(bad, func(answer *Answer, errorCode int) {
+		badChan <- errorCode
+	}, 5*time.Second); err != nil {
+		t.Fatalf("quest should be queued, err: %v", err)
+	}
+
+	codeChan := make(chan int, 1)
+	if err := client.SendQuestWithLambda(NewQuest("echo"), func(answer *Answer, errorCode int) {
+		codeChan <- errorCode
+	}, 5*time.Second); err != nil {
+		t.Fatalf("quest should be queued, err: %v", err)
+	}
+
+	newTestServerAt(t, endpoint, echoHandler)
+
+	for _, expect := range []struct {
+		codeChan chan int
+		code     int
+	}{{badChan, FPNN_EC_CORE_SEND_ERROR}, {codeChan, FPNN_EC_OK}} {
+		select {
+		case code := <-expect.codeChan:
+			if code != expect.code {
+				t.Fatalf("unexpected errorCode: %d, expect: %d", code, expect.code)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("queued quest was not flushed")
+		}
+	}
+}
+
+func TestOfflineQueueExpireAndFull(t *testing.T) {
+	client := NewTCPClient(closedEndpoint(t))
+	client.SetLogger(testLogger)
+	client.SetReconnectPolicy(&ReconnectPolicy{InitialDelay: time.Hour})
+	client.SetOfflineQueue(1, OfflineQueueRejectNew)
+	defer client.Close()
+
+	start := time.Now()
+	answer, err := client.SendQuest(NewQuest("test"), time.Second)
+	if err != nil {
+		t.Fatalf("quest should be queued, err: %v", err)
+	}
+	if code, _ := answer.GetInt("code"); code != FPNN_EC_CORE_TIMEOUT {
+		t.Fatalf("queued quest should expire, answer: %v", answer)
+	}
+	if cost := time.Since(start); cost > 3*time.Second {
+		t.Fatalf("queued quest expired too late: %v", cost)
+	}
+
+	if err := client.SendQuestWithLambda(NewQuest("test"), func(*Answer, int) {}); err != nil {
+		t.Fatalf("quest should be queued, err: %v", err)
+	}
+	if err := client.SendQuestWithLambda(NewQuest("test"), func(*Answer, int) {}); err != ErrOfflineQueueFull {
+		t.Fatalf("expect queue full error, err: %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package fpnn
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var DefaultLatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+const (
+	promCounter   = "counter"
+	promGauge     = "gauge"
+	promHistogram = "histogram"
+)
+
+type promSeries struct {
+	labels string
+	value  float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+type promFamily struct {
+	kind   string
+	series map[string]*promSeries
+}
+
+/*
+PrometheusSink is a MetricsSink which keeps the metrics in memory,
+and serves them in Prometheus text exposition format as an http.Handler.
+*/
+type PrometheusSink struct {
+	mutex    sync.Mutex
+	buckets  []float64
+	families map[string]*promFamily
+}
+
+/*
+buckets are the upper bounds of histogram buckets, in seconds. DefaultLatencyBuckets is used if no buckets are given.
+*/
+func NewPrometheusSink(buckets ...float64) *PrometheusSink {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+
+	sink := &PrometheusSink{}
+	sink.buckets = append([]float64(nil), buckets...)
+	sort.Float64s(sink.buckets)
+	sink.families = make(map[string]*promFamily)
+	return sink
+}
+
+// Returns nil if the name has been used by another kind of metric. Requires sink.mutex.
+func (sink *PrometheusSink) getSeries(kind string, name string, labels map[string]string) *promSeries {
+	family, ok := sink.families[name]
+	if !ok {
+		family = &promFamily{kind: kind, series: make(map[string]*promSeries)}
+		sink.families[name] = family
+	} else if family.kind != kind {
+		return nil
+	}
+
+	key := renderPromLabels(labels)
+	series, ok := family.series[key]
+	if !ok {
+		series = &promSeries{labels: key}
+		if kind == promHistogram {
+			series.counts = make([]uint64, len(sink.buckets))
+		}
+		family.series[key] = series
+	}
+	return series
+}
+
+func (sink *PrometheusSink) IncCounter(name string, labels map[string]string, delta float64) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if series := sink.getSeries(promCounter, name, labels); series != nil {
+		series.value += delta
+	}
+}
+
+func (sink *PrometheusSink) SetGauge(name string, labels map[string]string, value float64) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if series := sink.getSeries(promGauge, name, labels); series != nil {
+		series.value = value
+	}
+}
+
+func (sink *PrometheusSink) ObserveHistogram(name string, labels map[string]string, value float64) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	series := sink.getSeries(promHistogram, name, labels)
+	if series == nil {
+		return
+	}
+
+	if idx := sort.SearchFloat64s(sink.buckets, value); idx < len(sink.buckets) {
+		series.counts[idx] += 1
+	}
+	series.count += 1
+	series.sum += value
+}
+
+func (sink *PrometheusSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(sink.render())
+}
+
+func (sink *PrometheusSink) render() []byte {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	names := make([]string, 0, len(sink.families))
+	for name := range sink.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buffer bytes.Buffer
+	for _, name := range names {
+		family := sink.families[name]
+		buffer.WriteString("# TYPE " + name + " " + family.kind + "\n")
+
+		keys := make([]string, 0, len(family.series))
+		for key := range family.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			series := family.series[key]
+			if family.kind != promHistogram {
+				writePromSample(&buffer, name, series.labels, series.value)
+				continue
+			}
+
+			var cumulative uint64
+			for idx, bound := range sink.buckets {
+				cumulative += series.counts[idx]
+				writePromSample(&buffer, name+"_bucket", joinPromLabels(series.labels, `le="`+formatPromFloat(bound)+`"`), float64(cumulative))
+			}
+			writePromSample(&buffer, name+"_bucket", joinPromLabels(series.labels, `le="+Inf"`), float64(series.count))
+			writePromSample(&buffer, name+"_sum", series.labels, series.sum)
+			writePromSample(&buffer, name+"_count", series.labels, float64(series.count))
+		}
+	}
+	return buffer.Bytes()
+}
+
+func writePromSample(buffer *bytes.Buffer, name string, labels string, value float64) {
+	buffer.WriteString(name)
+	if len(labels) > 0 {
+		buffer.WriteString("{" + labels + "}")
+	}
+	buffer.WriteString(" " + formatPromFloat(value) + "\n")
+}
+
+func renderPromLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+`="`+escapePromLabelValue(labels[key])+`"`)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinPromLabels(labels string, pair string) string {
+	if len(labels) == 0 {
+		return pair
+	}
+	return labels + "," + pair
+}
+
+var promLabelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapePromLabelValue(value string) string {
+	return promLabelValueReplacer.Replace(value)
+}
+
+func formatPromFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
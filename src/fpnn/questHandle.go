@@ -0,0 +1,236 @@
+package fpnn
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrQuestCancelled = errors.New("Quest is cancelled.")
+
+/*
+QuestHandle cancels a sent quest.
+*/
+type QuestHandle struct {
+	cancelled int32
+	mutex     sync.Mutex
+	client    *TCPClient
+	quest     *Quest
+	callback  *connCallback
+	done      bool
+	cancelers []func()
+	ctx       context.Context
+}
+
+func (handle *QuestHandle) isCancelled() bool {
+	if handle == nil {
+		return false
+	}
+	if atomic.LoadInt32(&handle.cancelled) != 0 {
+		return true
+	}
+
+	//-- Only set for one-way quests sent by SendQuestWithContext().
+	return handle.ctx != nil && handle.ctx.Err() != nil
+}
+
+// Registers the function which removes a pending entry of the quest, e.g. the callback in answerMap.
+func (handle *QuestHandle) track(cancel func()) {
+	handle.mutex.Lock()
+	if !handle.done {
+		handle.cancelers = append(handle.cancelers, cancel)
+		handle.mutex.Unlock()
+		return
+	}
+	handle.mutex.Unlock()
+
+	if handle.isCancelled() {
+		go cancel()
+	}
+}
+
+// Returns false if the quest has been finished or cancelled.
+func (handle *QuestHandle) finish() bool {
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
+
+	if handle.done {
+		return false
+	}
+
+	handle.done = true
+	handle.cancelers = nil
+	return true
+}
+
+/*
+Cancel removes the pending callback, drops the quest from the write queue if it has not been written,
+and calls the callback with FPNN_EC_SDK_QUEST_CANCELLED.
+Returns false if the answer has been received, or the quest has been cancelled.
+
+For one-way quests, Cancel only drops the quest which has not been written.
+*/
+func (handle *QuestHandle) Cancel() bool {
+	handle.mutex.Lock()
+	if handle.done {
+		handle.mutex.Unlock()
+		return false
+	}
+
+	handle.done = true
+	atomic.StoreInt32(&handle.cancelled, 1)
+	cancelers := handle.cancelers
+	handle.cancelers = nil
+	handle.mutex.Unlock()
+
+	//-- Pending entries are completed before the callback, so the resources they hold are released first.
+	handle.client.getCallbackExecutor().Execute(func() {
+		for _, cancel := range cancelers {
+			cancel()
+		}
+
+		if handle.callback != nil {
+			answer := newErrorAnswerWitSeqNum(handle.quest.seqNum, FPNN_EC_SDK_QUEST_CANCELLED, "Quest is cancelled.")
+			callAnswerCallback(answer, handle.callback)
+		}
+	})
+	return true
+}
+
+//-----------------[ tcpConnection cancellation ]-----------------//
+
+func (conn *tcpConnection) cancelQuestCallback(seqNum uint32, cb *connCallback) {
+	conn.mutex.Lock()
+	callback, ok := conn.answerMap[seqNum]
+	if !ok || callback != cb {
+		conn.mutex.Unlock()
+		return
+	}
+
+	delete(conn.answerMap, seqNum)
+	conn.notifyAnswersDrained()
+	conn.mutex.Unlock()
+
+	//-- Completes the inner callbacks, so flow control slots, circuit breaker probes and hedges are released.
+	answer := newErrorAnswerWitSeqNum(seqNum, FPNN_EC_SDK_QUEST_CANCELLED, "Quest is cancelled.")
+	conn.stats.questCompleted(cb, FPNN_EC_SDK_QUEST_CANCELLED)
+	callAnswerCallback(answer, cb)
+}
+
+//-----------------[ TCPClient cancelable sending ]-----------------//
+
+func (client *TCPClient) getCallbackExecutor() CallbackExecutor {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.executor != nil {
+		return client.executor
+	}
+	return client.routines.executor()
+}
+
+func (client *TCPClient) sendCancelableQuest(quest *Quest, cb *connCallback) (*QuestHandle, error) {
+
+	handle := &QuestHandle{client: client, quest: quest, callback: cb}
+
+	var wrapped *connCallback
+	if cb != nil {
+		wrapped = &connCallback{}
+		wrapped.deadline = cb.deadline
+		wrapped.callbackFunc = func(answer *Answer, errorCode int) {
+			if handle.finish() {
+				callAnswerCallback(answer, cb)
+			}
+		}
+	}
+
+	if err := client.realSendQuest(quest, wrapped, handle); err != nil {
+		handle.finish()
+		return nil, err
+	}
+	return handle, nil
+}
+
+func (client *TCPClient) SendCancelableQuestWithCallback(quest *Quest, callback AnswerCallback, timeout ...time.Duration) (*QuestHandle, error) {
+
+	var cb *connCallback
+	if quest.isTwoWay {
+		cb = &connCallback{}
+		cb.deadline = time.Now().Add(client.questTimeout(timeout))
+		cb.callback = callback
+	}
+
+	return client.sendCancelableQuest(quest, cb)
+}
+
+func (client *TCPClient) SendCancelableQuestWithLambda(quest *Quest, callback func(answer *Answer, errorCode int), timeout ...time.Duration) (*QuestHandle, error) {
+
+	var cb *connCallback
+	if quest.isTwoWay {
+		cb = &connCallback{}
+		cb.deadline = time.Now().Add(client.questTimeout(timeout))
+		cb.callbackFunc = callback
+	}
+
+	return client.sendCancelableQuest(quest, cb)
+}
+
+/*
+The quest is cancelled when ctx is done, and ctx.Err() is returned.
+One-way quests are dropped if ctx is done before they are written, including the ones in the offline queue.
+*/
+func (client *TCPClient) SendQuestWithContext(ctx context.Context, quest *Quest, timeout ...time.Duration) (*Answer, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	quest.ctx = ctx
+
+	if !quest.isTwoWay {
+		handle := &QuestHandle{client: client, quest: quest, ctx: ctx}
+		err := client.realSendQuest(quest, nil, handle)
+		if ctx.Err() != nil && errors.Is(err, ErrQuestCancelled) {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	answerChan := make(chan *Answer, 1)
+
+	cb := &connCallback{}
+	cb.deadline = time.Now().Add(client.questTimeout(timeout))
+	cb.callbackFunc = func(answer *Answer, errorCode int) {
+		answerChan <- answer
+	}
+
+	handle, err := client.sendCancelableQuest(quest, cb)
+	if err != nil {
+		//-- Cancelled by ctx while waiting for flow control.
+		if ctx.Err() != nil && errors.Is(err, ErrQuestCancelled) {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	select {
+	case answer := <-answerChan:
+		return answer, nil
+	case <-ctx.Done():
+		if handle.Cancel() {
+			return nil, ctx.Err()
+		}
+		return <-answerChan, nil
+	}
+}
+
+func (client *TCPClient) questTimeout(timeout []time.Duration) time.Duration {
+	if len(timeout) == 1 && timeout[0] != 0 {
+		return timeout[0]
+	} else if len(timeout) > 1 {
+		panic("Invalid params when call FPNN.TCPCLient.SendQuest() function.")
+	}
+	return client.defaultQuestTimeout()
+}
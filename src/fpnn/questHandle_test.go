@@ -0,0 +1,117 @@
+package fpnn
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCancelQuest(t *testing.T) {
+	server := newTestServer(t, func(quest *Quest) *Answer {
+		time.Sleep(300 * time.Millisecond)
+		return NewAnswer(quest)
+	})
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetFlowControl(&FlowControlPolicy{MaxInFlight: 1})
+	defer client.Close()
+
+	var calls int32
+	codes := make(chan int, 2)
+	handle, err := client.SendCancelableQuestWithLambda(NewQuest("slow"), func(answer *Answer, errorCode int) {
+		atomic.AddInt32(&calls, 1)
+		codes <- errorCode
+	})
+	if err != nil {
+		t.Fatalf("send quest failed, err: %v", err)
+	}
+
+	if !handle.Cancel() {
+		t.Fatalf("cancel pending quest failed")
+	}
+	if handle.Cancel() {
+		t.Fatalf("quest is cancelled twice")
+	}
+
+	select {
+	case code := <-codes:
+		if code != FPNN_EC_SDK_QUEST_CANCELLED {
+			t.Fatalf("unexpected error code: %d", code)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("callback is not called after cancelling")
+	}
+
+	client.mutex.Lock()
+	conn := client.conn
+	client.mutex.Unlock()
+
+	conn.mutex.Lock()
+	pending := len(conn.answerMap)
+	conn.mutex.Unlock()
+	if pending != 0 {
+		t.Fatalf("%d callbacks are still pending after cancelling", pending)
+	}
+
+	//-- The in-flight slot is released by cancelling.
+	if _, err := client.SendCancelableQuestWithLambda(NewQuest("slow"), func(answer *Answer, errorCode int) {}); err != nil {
+		t.Fatalf("send quest after cancelling failed, err: %v", err)
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("callback is called %d times", calls)
+	}
+}
+
+func TestSendQuestWithContext(t *testing.T) {
+	server := newTestServer(t, func(quest *Quest) *Answer {
+		if quest.Method() == "slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		return NewAnswer(quest)
+	})
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	defer client.Close()
+
+	if _, err := client.SendQuestWithContext(context.Background(), NewQuest("fast")); err != nil {
+		t.Fatalf("send quest failed, err: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := client.SendQuestWithContext(ctx, NewQuest("slow")); err != context.DeadlineExceeded {
+		t.Fatalf("expect deadline exceeded, err: %v", err)
+	}
+	if cost := time.Since(start); cost > 200*time.Millisecond {
+		t.Fatalf("quest is not cancelled in time, cost: %v", cost)
+	}
+}
+
+func TestCancelledFrameIsDropped(t *testing.T) {
+	handle := &QuestHandle{client: &TCPClient{}}
+	batch := &writeBatch{}
+
+	batch.append(writeFrame{data: []byte("kept")})
+	handle.Cancel()
+	batch.append(writeFrame{data: []byte("dropped"), handle: handle})
+
+	if len(batch.frames) != 1 || batch.size != 4 {
+		t.Fatalf("cancelled frame is not dropped: %d frames, %d bytes", len(batch.frames), batch.size)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	oneWay := &QuestHandle{client: &TCPClient{}, ctx: ctx}
+	cancel()
+	batch.append(writeFrame{data: []byte("dropped"), handle: oneWay})
+
+	if len(batch.frames) != 1 {
+		t.Fatalf("one-way frame is not dropped after its context is done: %d frames", len(batch.frames))
+	}
+}
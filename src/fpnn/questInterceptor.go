@@ -0,0 +1,78 @@
+package fpnn
+
+import "errors"
+
+var ErrNilQuestCallback = errors.New("Callback of two-way quest is nil.")
+
+/*
+QuestInvoker sends the quest to the next interceptor, or to the connection if it is the last one.
+callback is nil for one-way quests. It returns ErrNilQuestCallback if callback is nil for a two-way quest.
+*/
+type QuestInvoker func(quest *Quest, callback func(answer *Answer, errorCode int)) error
+
+/*
+QuestInterceptor wraps every sending of the client, including SendQuest(), SendQuestWithCallback() and SendQuestWithLambda().
+
+An interceptor can:
+
+	modify the quest, or pass a different quest to invoker;
+	wrap callback to inspect the answer and the latency, and pass the wrapper to invoker;
+	short-circuit by calling callback itself and returning nil without calling invoker.
+
+For two-way quests, callback must be called exactly once, either by the interceptor itself or through invoker.
+*/
+type QuestInterceptor func(quest *Quest, callback func(answer *Answer, errorCode int), invoker QuestInvoker) error
+
+/*
+Interceptors are called in order: the first one is the outermost. Call without params to remove all interceptors.
+*/
+func (client *TCPClient) SetQuestInterceptors(interceptors ...QuestInterceptor) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.interceptors = append([]QuestInterceptor(nil), interceptors...)
+}
+
+func (client *TCPClient) getQuestInterceptors() []QuestInterceptor {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.interceptors
+}
+
+func (client *TCPClient) sendQuestWithInterceptors(quest *Quest, cb *connCallback, interceptors []QuestInterceptor) error {
+
+	invoker := func(quest *Quest, callback func(answer *Answer, errorCode int)) error {
+		if quest.isTwoWay && callback == nil {
+			return ErrNilQuestCallback
+		}
+
+		var inner *connCallback
+		if cb != nil && callback != nil {
+			inner = &connCallback{}
+			inner.deadline = cb.deadline
+			inner.callbackFunc = callback
+		}
+		return client.invokeQuest(quest, inner)
+	}
+
+	for idx := len(interceptors) - 1; idx >= 0; idx-- {
+		interceptor := interceptors[idx]
+		next := invoker
+		invoker = func(quest *Quest, callback func(answer *Answer, errorCode int)) error {
+			return interceptor(quest, callback, next)
+		}
+	}
+
+	var callback func(answer *Answer, errorCode int)
+	if cb != nil {
+		callback = func(answer *Answer, errorCode int) {
+			if answer == nil {
+				answer = newErrorAnswerWitSeqNum(quest.seqNum, errorCode, "")
+			}
+			callAnswerCallback(answer, cb)
+		}
+	}
+
+	return invoker(quest, callback)
+}
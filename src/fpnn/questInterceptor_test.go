@@ -0,0 +1,122 @@
+package fpnn
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQuestInterceptorsWrapAllSendings(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	defer client.Close()
+
+	var mutex sync.Mutex
+	var calls []string
+	var latencies []time.Duration
+
+	tokenInterceptor := func(quest *Quest, callback func(answer *Answer, errorCode int), invoker QuestInvoker) error {
+		mutex.Lock()
+		calls = append(calls, "token")
+		mutex.Unlock()
+
+		quest.Param("token", "secret")
+		return invoker(quest, callback)
+	}
+
+	timingInterceptor := func(quest *Quest, callback func(answer *Answer, errorCode int), invoker QuestInvoker) error {
+		mutex.Lock()
+		calls = append(calls, "timing")
+		mutex.Unlock()
+
+		if callback == nil {
+			return invoker(quest, nil)
+		}
+
+		start := time.Now()
+		return invoker(quest, func(answer *Answer, errorCode int) {
+			mutex.Lock()
+			latencies = append(latencies, time.Since(start))
+			mutex.Unlock()
+
+			callback(answer, errorCode)
+		})
+	}
+
+	cacheInterceptor := func(quest *Quest, callback func(answer *Answer, errorCode int), invoker QuestInvoker) error {
+		if quest.Method() != "cached" {
+			return invoker(quest, callback)
+		}
+
+		answer := NewAnswer(quest)
+		answer.Param("cached", true)
+		callback(answer, FPNN_EC_OK)
+		return nil
+	}
+
+	client.SetQuestInterceptors(tokenInterceptor, timingInterceptor, cacheInterceptor)
+
+	answer, err := client.SendQuest(NewQuest("test"))
+	if err != nil {
+		t.Fatalf("send quest failed, err: %v", err)
+	}
+	if token, _ := answer.GetString("token"); token != "secret" {
+		t.Fatalf("quest is not modified by interceptor: %v", answer.data)
+	}
+
+	done := make(chan *Answer, 1)
+	if err := client.SendQuestWithLambda(NewQuest("cached"), func(answer *Answer, errorCode int) { done <- answer }); err != nil {
+		t.Fatalf("send quest failed, err: %v", err)
+	}
+	if cached, _ := (<-done).GetBool("cached"); !cached {
+		t.Fatalf("quest is not short-circuited")
+	}
+
+	if err := client.SendQuestWithCallback(NewOneWayQuest("oneway"), nil); err != nil {
+		t.Fatalf("send one way quest failed, err: %v", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	expected := []string{"token", "timing", "token", "timing", "token", "timing"}
+	if len(calls) != len(expected) {
+		t.Fatalf("interceptor calls: %v", calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Fatalf("interceptor calls: %v", calls)
+		}
+	}
+	if len(latencies) != 2 {
+		t.Fatalf("latencies observed: %v", latencies)
+	}
+}
+
+func TestQuestInterceptorDropsCallback(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetQuestInterceptors(func(quest *Quest, callback func(answer *Answer, errorCode int), invoker QuestInvoker) error {
+		return invoker(quest, nil)
+	})
+	defer client.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.SendQuest(NewQuest("echo"))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != ErrNilQuestCallback {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("quest with dropped callback is blocked")
+	}
+}
@@ -0,0 +1,158 @@
+package fpnn
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+QuestMiddleware wraps the handler of incoming quests. It can inspect or modify the quest,
+answer it directly without calling next, or inspect and replace the answer and the error.
+
+For one-way quests, the answer must be nil.
+*/
+type QuestMiddleware func(next QuestHandler) QuestHandler
+
+/*
+The first middleware is the outermost.
+*/
+func ChainQuestMiddlewares(handler QuestHandler, middlewares ...QuestMiddleware) QuestHandler {
+	for idx := len(middlewares) - 1; idx >= 0; idx-- {
+		handler = middlewares[idx](handler)
+	}
+	return handler
+}
+
+/*
+Middlewares run around every handler returned by the QuestProcessor of the client.
+Call without params to remove all middlewares.
+*/
+func (client *TCPClient) SetQuestMiddlewares(middlewares ...QuestMiddleware) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.middlewares = append([]QuestMiddleware(nil), middlewares...)
+	if client.conn != nil {
+		client.conn.setQuestMiddlewares(client.middlewares)
+	}
+}
+
+func (conn *tcpConnection) setQuestMiddlewares(middlewares []QuestMiddleware) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	conn.middlewares = middlewares
+}
+
+func (conn *tcpConnection) wrapQuestHandler(handler QuestHandler) QuestHandler {
+	conn.mutex.Lock()
+	middlewares := conn.middlewares
+	tracing := conn.tracing
+	conn.mutex.Unlock()
+
+	handler = ChainQuestMiddlewares(handler, middlewares...)
+	if tracing != nil {
+		//-- The server span covers all middlewares.
+		handler = newTracingMiddleware(tracing)(handler)
+	}
+	return handler
+}
+
+//-----------------[ built-in middlewares ]-----------------//
+
+// Without logger, the quests are logged by the logger of the client which receives them.
+func middlewareLogger(logger Logger) func(quest *Quest) LeveledLogger {
+	if logger != nil {
+		leveled := toLeveledLogger(logger)
+		return func(quest *Quest) LeveledLogger {
+			return leveled
+		}
+	}
+
+	return func(quest *Quest) LeveledLogger {
+		if quest.conn != nil {
+			return quest.conn.logger
+		}
+		return toLeveledLogger(Config.logger)
+	}
+}
+
+/*
+Converts the panics of handlers to FPNN_EC_CORE_UNKNOWN_ERROR answers.
+The logger can be nil, then the logger of the client is used.
+*/
+func NewRecoverMiddleware(logger Logger) QuestMiddleware {
+	leveled := middlewareLogger(logger)
+
+	return func(next QuestHandler) QuestHandler {
+		return func(quest *Quest) (answer *Answer, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					leveled(quest).Error("Process quest panic.", "method", quest.method, "seqNum", quest.seqNum, "panic", r)
+
+					answer = nil
+					err = nil
+					if quest.isTwoWay {
+						answer = NewErrorAnswer(quest, FPNN_EC_CORE_UNKNOWN_ERROR, fmt.Sprintf("Process quest panic: %v", r))
+					}
+				}
+			}()
+
+			return next(quest)
+		}
+	}
+}
+
+/*
+Logs the method, the cost time and the result of each quest.
+The logger can be nil, then the logger of the client is used.
+*/
+func NewLoggingMiddleware(logger Logger) QuestMiddleware {
+	leveled := middlewareLogger(logger)
+
+	return func(next QuestHandler) QuestHandler {
+		return func(quest *Quest) (*Answer, error) {
+			start := time.Now()
+			answer, err := next(quest)
+			cost := time.Since(start)
+
+			switch {
+			case err != nil:
+				leveled(quest).Info("Quest processed.", "method", quest.method, "seqNum", quest.seqNum, "cost", cost, "err", err)
+			case answer != nil && answer.IsException():
+				code, _ := answer.GetInt("code")
+				leveled(quest).Info("Quest processed.", "method", quest.method, "seqNum", quest.seqNum, "cost", cost, "errorCode", code)
+			default:
+				leveled(quest).Info("Quest processed.", "method", quest.method, "seqNum", quest.seqNum, "cost", cost)
+			}
+			return answer, err
+		}
+	}
+}
+
+/*
+Limits the rate of the quests of the listed methods, in quests per second.
+Two-way quests exceeding the limit are answered with FPNN_EC_CORE_WORK_QUEUE_FULL, and one-way quests are dropped.
+*/
+func NewMethodRateLimitMiddleware(rates map[string]float64) QuestMiddleware {
+	buckets := make(map[string]*tokenBucket)
+	for method, rate := range rates {
+		if rate > 0 {
+			buckets[method] = newTokenBucket(rate, 0)
+		}
+	}
+
+	return func(next QuestHandler) QuestHandler {
+		return func(quest *Quest) (*Answer, error) {
+			if bucket, ok := buckets[quest.method]; ok {
+				if _, err := bucket.reserve(false, time.Time{}); err != nil {
+					if quest.isTwoWay {
+						return NewErrorAnswer(quest, FPNN_EC_CORE_WORK_QUEUE_FULL, "Quest is rejected by rate limiter."), nil
+					}
+					return nil, nil
+				}
+			}
+			return next(quest)
+		}
+	}
+}
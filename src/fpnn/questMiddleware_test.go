@@ -0,0 +1,76 @@
+package fpnn
+
+import (
+	"testing"
+)
+
+func TestQuestMiddlewares(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	router := NewQuestRouter()
+	router.Handle("echo", func(quest *Quest) (*Answer, error) {
+		answer := NewAnswer(quest)
+		answer.Param("user", quest.WantString("user"))
+		return answer, nil
+	})
+	router.Handle("panic", func(quest *Quest) (*Answer, error) {
+		panic("handler bug")
+	})
+
+	authMiddleware := func(next QuestHandler) QuestHandler {
+		return func(quest *Quest) (*Answer, error) {
+			if token, _ := quest.GetString("token"); token != "secret" {
+				return NewErrorAnswer(quest, FPNN_EC_CORE_FORBIDDEN, "Invalid token."), nil
+			}
+			quest.Param("user", "admin")
+			return next(quest)
+		}
+	}
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetQuestProcessor(router)
+	client.SetQuestMiddlewares(
+		NewRecoverMiddleware(testLogger),
+		NewLoggingMiddleware(testLogger),
+		authMiddleware,
+		NewMethodRateLimitMiddleware(map[string]float64{"echo": 1}),
+	)
+	defer client.Close()
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	expectCode := func(seqNum uint32, expected int) *Answer {
+		answer := waitServerAnswer(t, server)
+		code, _ := answer.GetInt("code")
+		if answer.SeqNum() != seqNum || code != expected {
+			t.Fatalf("answer of quest %d: seqNum %d, code %d, expected code %d", seqNum, answer.SeqNum(), code, expected)
+		}
+		return answer
+	}
+
+	quest := NewQuest("echo")
+	quest.seqNum = 1
+	server.pushQuest(t, quest)
+	expectCode(1, FPNN_EC_CORE_FORBIDDEN)
+
+	quest = NewQuest("echo")
+	quest.seqNum = 2
+	quest.Param("token", "secret")
+	server.pushQuest(t, quest)
+	if user, _ := expectCode(2, FPNN_EC_OK).GetString("user"); user != "admin" {
+		t.Fatalf("quest is not modified by middleware")
+	}
+
+	quest.seqNum = 3
+	server.pushQuest(t, quest)
+	expectCode(3, FPNN_EC_CORE_WORK_QUEUE_FULL)
+
+	quest = NewQuest("panic")
+	quest.seqNum = 4
+	quest.Param("token", "secret")
+	server.pushQuest(t, quest)
+	expectCode(4, FPNN_EC_CORE_UNKNOWN_ERROR)
+}
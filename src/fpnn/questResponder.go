@@ -0,0 +1,64 @@
+package fpnn
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrAnswerSent = errors.New("Answer has been sent.")
+
+/*
+QuestResponder sends the answer of a deferred two-way quest, from any goroutine.
+*/
+type QuestResponder struct {
+	mutex sync.Mutex
+	quest *Quest
+	conn  *tcpConnection
+	sent  bool
+}
+
+/*
+Called in the handler of an incoming two-way quest, to answer the quest later by the returned responder.
+The handler can return a nil answer after that.
+Returns nil for one-way quests, or quests which are not received from a connection.
+*/
+func (quest *Quest) DeferAnswer() *QuestResponder {
+	if !quest.isTwoWay || quest.conn == nil {
+		return nil
+	}
+
+	if quest.responder == nil {
+		quest.responder = &QuestResponder{quest: quest, conn: quest.conn}
+	}
+	return quest.responder
+}
+
+func (quest *Quest) isDeferred() bool {
+	return quest.responder != nil
+}
+
+/*
+The answer can be sent only once. Later calls return ErrAnswerSent.
+Returns an error if the connection has been closed.
+*/
+func (responder *QuestResponder) SendAnswer(answer *Answer) error {
+	responder.mutex.Lock()
+	defer responder.mutex.Unlock()
+
+	if responder.sent {
+		return ErrAnswerSent
+	}
+	responder.sent = true
+
+	answer.seqNum = responder.quest.seqNum
+	err := responder.conn.sendAnswer(answer)
+
+	if answerSent := responder.quest.answerSent; answerSent != nil {
+		answerSent(answer)
+	}
+	return err
+}
+
+func (responder *QuestResponder) SendErrorAnswer(code int, ex string) error {
+	return responder.SendAnswer(NewErrorAnswer(responder.quest, code, ex))
+}
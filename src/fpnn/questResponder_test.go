@@ -0,0 +1,66 @@
+package fpnn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeferredAnswer(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	responders := make(chan *QuestResponder, 2)
+	router := NewQuestRouter()
+	router.Handle("async", func(quest *Quest) (*Answer, error) {
+		responders <- quest.DeferAnswer()
+		return nil, nil
+	})
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetQuestProcessor(router)
+	defer client.Close()
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	pushTwoWayQuest(t, server, "async", 1)
+	responder := <-responders
+	if responder == nil {
+		t.Fatalf("DeferAnswer() returns nil for two-way quest")
+	}
+
+	//-- The read loop is not blocked by the pending answer.
+	if _, err := client.SendQuest(NewQuest("test"), 2*time.Second); err != nil {
+		t.Fatalf("send quest failed, err: %v", err)
+	}
+
+	go func() {
+		answer := NewAnswer(responder.quest)
+		answer.Param("async", true)
+		if err := responder.SendAnswer(answer); err != nil {
+			t.Errorf("send deferred answer failed, err: %v", err)
+		}
+	}()
+
+	answer := waitServerAnswer(t, server)
+	if async, _ := answer.GetBool("async"); answer.SeqNum() != 1 || !async {
+		t.Fatalf("unexpected answer: %d %v", answer.SeqNum(), answer.data)
+	}
+
+	if err := responder.SendErrorAnswer(FPNN_EC_CORE_UNKNOWN_ERROR, "again"); err != ErrAnswerSent {
+		t.Fatalf("answer is sent twice, err: %v", err)
+	}
+
+	pushTwoWayQuest(t, server, "async", 2)
+	responder = <-responders
+	client.Close()
+
+	if err := responder.SendAnswer(NewAnswer(responder.quest)); err == nil {
+		t.Fatalf("sending answer on closed connection succeeded")
+	}
+
+	if NewQuest("local").DeferAnswer() != nil {
+		t.Fatalf("DeferAnswer() returns responder for local quest")
+	}
+}
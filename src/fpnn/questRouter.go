@@ -0,0 +1,142 @@
+package fpnn
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+type QuestHandler func(quest *Quest) (*Answer, error)
+
+type prefixHandler struct {
+	prefix  string
+	handler QuestHandler
+}
+
+/*
+QuestRouter is a QuestProcessor which dispatches quests by method.
+
+	"method":	matches the method exactly.
+	"prefix*":	matches the methods starting with prefix. The longest prefix wins.
+
+Built-in methods, whose names start with '*' (e.g. "*ping"), only match exact registrations,
+and are never routed to prefix handlers or the fallback handler.
+*/
+type QuestRouter struct {
+	mutex    sync.RWMutex
+	handlers map[string]QuestHandler
+	prefixes []prefixHandler
+	fallback QuestHandler
+}
+
+/*
+The router answers "*ping" and "*infos" by default. Both can be overridden by Handle().
+*/
+func NewQuestRouter() *QuestRouter {
+	router := &QuestRouter{handlers: make(map[string]QuestHandler)}
+
+	router.handlers["*ping"] = func(quest *Quest) (*Answer, error) {
+		return NewAnswer(quest), nil
+	}
+	router.handlers["*infos"] = router.infos
+	return router
+}
+
+func isBuiltinMethod(method string) bool {
+	return len(method) > 1 && method[0] == '*'
+}
+
+func (router *QuestRouter) infos(quest *Quest) (*Answer, error) {
+	answer := NewAnswer(quest)
+	answer.Param("sdk", "go")
+	answer.Param("version", SDKVersion)
+	answer.Param("methods", router.Methods())
+	return answer, nil
+}
+
+/*
+Set nil handler to remove the registration.
+*/
+func (router *QuestRouter) Handle(pattern string, handler QuestHandler) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	if !strings.HasSuffix(pattern, "*") {
+		if handler == nil {
+			delete(router.handlers, pattern)
+		} else {
+			router.handlers[pattern] = handler
+		}
+		return
+	}
+
+	prefix := strings.TrimSuffix(pattern, "*")
+	for idx, item := range router.prefixes {
+		if item.prefix == prefix {
+			router.prefixes = append(router.prefixes[:idx], router.prefixes[idx+1:]...)
+			break
+		}
+	}
+
+	if handler == nil {
+		return
+	}
+
+	router.prefixes = append(router.prefixes, prefixHandler{prefix: prefix, handler: handler})
+	sort.SliceStable(router.prefixes, func(i, j int) bool {
+		return len(router.prefixes[i].prefix) > len(router.prefixes[j].prefix)
+	})
+}
+
+/*
+The fallback handler processes the quests which no pattern matches. Set nil to remove it.
+*/
+func (router *QuestRouter) SetFallback(handler QuestHandler) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	router.fallback = handler
+}
+
+/*
+Returns the registered methods and patterns, sorted.
+*/
+func (router *QuestRouter) Methods() []string {
+	router.mutex.RLock()
+	defer router.mutex.RUnlock()
+
+	methods := make([]string, 0, len(router.handlers)+len(router.prefixes))
+	for method := range router.handlers {
+		methods = append(methods, method)
+	}
+	for _, item := range router.prefixes {
+		methods = append(methods, item.prefix+"*")
+	}
+
+	sort.Strings(methods)
+	return methods
+}
+
+func (router *QuestRouter) Process(method string) func(*Quest) (*Answer, error) {
+	router.mutex.RLock()
+	defer router.mutex.RUnlock()
+
+	if handler, ok := router.handlers[method]; ok {
+		return handler
+	}
+
+	if isBuiltinMethod(method) {
+		return nil
+	}
+
+	for _, item := range router.prefixes {
+		if strings.HasPrefix(method, item.prefix) {
+			return item.handler
+		}
+	}
+
+	if router.fallback != nil {
+		return router.fallback
+	}
+	return nil
+}
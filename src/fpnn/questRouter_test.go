@@ -0,0 +1,87 @@
+package fpnn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func answerWith(name string) QuestHandler {
+	return func(quest *Quest) (*Answer, error) {
+		answer := NewAnswer(quest)
+		answer.Param("handler", name)
+		return answer, nil
+	}
+}
+
+func routedHandler(t *testing.T, router *QuestRouter, method string) string {
+	handler := router.Process(method)
+	if handler == nil {
+		return ""
+	}
+
+	answer, err := handler(NewQuest(method))
+	if err != nil {
+		t.Fatalf("handler of %s failed: %v", method, err)
+	}
+	name, _ := answer.GetString("handler")
+	return name
+}
+
+func TestQuestRouterMatching(t *testing.T) {
+	router := NewQuestRouter()
+	router.Handle("user.login", answerWith("login"))
+	router.Handle("user.*", answerWith("user"))
+	router.Handle("user.admin.*", answerWith("admin"))
+
+	cases := map[string]string{
+		"user.login":       "login",
+		"user.logout":      "user",
+		"user.admin.ban":   "admin",
+		"room.enter":       "",
+		"*unknownBuiltin":  "",
+		"user.admin.":      "admin",
+		"user.login.extra": "user",
+	}
+	for method, expected := range cases {
+		if got := routedHandler(t, router, method); got != expected {
+			t.Errorf("method %s is routed to %q, expected %q", method, got, expected)
+		}
+	}
+
+	router.SetFallback(answerWith("fallback"))
+	if got := routedHandler(t, router, "room.enter"); got != "fallback" {
+		t.Errorf("fallback is not used, got %q", got)
+	}
+	if router.Process("*unknownBuiltin") != nil {
+		t.Errorf("built-in method is routed to fallback")
+	}
+
+	router.Handle("user.*", nil)
+	if got := routedHandler(t, router, "user.logout"); got != "fallback" {
+		t.Errorf("removed pattern still matches, got %q", got)
+	}
+
+	expected := []string{"*infos", "*ping", "user.admin.*", "user.login"}
+	if methods := router.Methods(); !reflect.DeepEqual(methods, expected) {
+		t.Errorf("methods: %v, expected %v", methods, expected)
+	}
+}
+
+func TestQuestRouterBuiltinMethods(t *testing.T) {
+	router := NewQuestRouter()
+
+	answer, _ := router.Process("*ping")(NewQuest("*ping"))
+	if answer == nil || answer.IsException() {
+		t.Fatalf("*ping is not answered")
+	}
+
+	answer, _ = router.Process("*infos")(NewQuest("*infos"))
+	if version, _ := answer.GetString("version"); version != SDKVersion {
+		t.Fatalf("*infos answer: %v", answer.data)
+	}
+
+	router.Handle("*ping", answerWith("custom"))
+	if got := routedHandler(t, router, "*ping"); got != "custom" {
+		t.Fatalf("built-in method is not overridden, got %q", got)
+	}
+}
@@ -0,0 +1,223 @@
+package fpnn
+
+import (
+	"sync"
+)
+
+type QuestPoolFullPolicy int
+
+const (
+	QuestPoolFullReject QuestPoolFullPolicy = iota
+	QuestPoolFullBlock
+)
+
+type questTask struct {
+	method string
+	task   func()
+}
+
+// Workers are started on demand, and exit when the queue is empty.
+type questWorkerPool struct {
+	mutex      sync.Mutex
+	cond       *sync.Cond
+	maxWorkers int
+	maxQueued  int
+	fullPolicy QuestPoolFullPolicy
+	workers    int
+	queue      []questTask
+	limits     map[string]int
+	pending    map[string]int
+}
+
+func newQuestWorkerPool(workers int, queueSize int, fullPolicy QuestPoolFullPolicy, limits map[string]int) *questWorkerPool {
+	pool := &questWorkerPool{
+		maxWorkers: workers,
+		maxQueued:  queueSize,
+		fullPolicy: fullPolicy,
+		limits:     make(map[string]int),
+		pending:    make(map[string]int),
+	}
+	pool.cond = sync.NewCond(&pool.mutex)
+
+	for method, limit := range limits {
+		pool.limits[method] = limit
+	}
+	return pool
+}
+
+func (pool *questWorkerPool) setMethodLimit(method string, limit int) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if limit <= 0 {
+		delete(pool.limits, method)
+	} else {
+		pool.limits[method] = limit
+	}
+	pool.cond.Broadcast()
+}
+
+// Requires pool.mutex.
+func (pool *questWorkerPool) full(method string) bool {
+	if limit, ok := pool.limits[method]; ok && pool.pending[method] >= limit {
+		return true
+	}
+	return pool.workers >= pool.maxWorkers && len(pool.queue) >= pool.maxQueued
+}
+
+// Wakes up the blocked submit() calls, so they can check whether the connection is closed.
+func (pool *questWorkerPool) wakeUp() {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	pool.cond.Broadcast()
+}
+
+/*
+Workers are started in routines. Returns false if the quest is rejected by QuestPoolFullReject,
+or stopped() returns true while waiting for QuestPoolFullBlock.
+*/
+func (pool *questWorkerPool) submit(method string, task func(), routines *goroutineGroup, stopped func() bool) bool {
+	pool.mutex.Lock()
+
+	for pool.full(method) {
+		if pool.fullPolicy != QuestPoolFullBlock || stopped() {
+			pool.mutex.Unlock()
+			return false
+		}
+		pool.cond.Wait()
+	}
+
+	pool.pending[method] += 1
+
+	item := questTask{method: method, task: task}
+	if pool.workers < pool.maxWorkers {
+		pool.workers += 1
+		pool.mutex.Unlock()
+
+		routines.start(func() {
+			pool.workLoop(item)
+		})
+		return true
+	}
+
+	pool.queue = append(pool.queue, item)
+	pool.mutex.Unlock()
+	return true
+}
+
+func (pool *questWorkerPool) workLoop(item questTask) {
+	for {
+		item.task()
+
+		pool.mutex.Lock()
+		if pool.pending[item.method] <= 1 {
+			delete(pool.pending, item.method)
+		} else {
+			pool.pending[item.method] -= 1
+		}
+		pool.cond.Broadcast()
+
+		if len(pool.queue) == 0 {
+			pool.workers -= 1
+			pool.mutex.Unlock()
+			return
+		}
+
+		item = pool.queue[0]
+		pool.queue[0] = questTask{}
+		pool.queue = pool.queue[1:]
+		pool.mutex.Unlock()
+	}
+}
+
+//-----------------[ tcpConnection quest dispatching ]-----------------//
+
+func (conn *tcpConnection) setQuestPool(pool *questWorkerPool) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	conn.questPool = pool
+}
+
+func (conn *tcpConnection) dispatchQuest(quest *Quest) {
+
+	conn.mutex.Lock()
+	pool := conn.questPool
+	conn.mutex.Unlock()
+
+	if pool == nil {
+		conn.dealQuest(quest)
+		return
+	}
+
+	stopped := func() bool { return !conn.isConnected() }
+	if pool.submit(quest.method, func() { conn.dealQuest(quest) }, conn.routines, stopped) {
+		return
+	}
+
+	if stopped() {
+		return
+	}
+
+	if !quest.isTwoWay {
+		conn.logWarn("Quest worker pool is full, oneway quest is dropped.", "method", quest.method)
+		return
+	}
+
+	answer := NewErrorAnswer(quest, FPNN_EC_CORE_WORK_QUEUE_FULL, "Quest worker pool is full.")
+	if err := conn.sendAnswer(answer); err != nil {
+		conn.logError("Quest worker pool is full. Send error answer failed.", "method", quest.method, "seqNum", quest.seqNum, "err", err)
+	}
+}
+
+//-----------------[ TCPClient quest worker pool ]-----------------//
+
+/*
+Quests pushed by server are processed by at most workers goroutines, instead of the read loop of the connection.
+queueSize quests can wait for a free worker. When both are exhausted, fullPolicy decides:
+
+	QuestPoolFullReject:	two-way quests are answered with FPNN_EC_CORE_WORK_QUEUE_FULL, and one-way quests are dropped.
+	QuestPoolFullBlock:		the read loop waits for a free worker.
+
+workers <= 0 disables the pool, and quests are processed in the read loop.
+*/
+func (client *TCPClient) SetQuestWorkerPool(workers int, queueSize int, fullPolicy QuestPoolFullPolicy) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if workers <= 0 {
+		client.questPool = nil
+	} else {
+		if queueSize < 0 {
+			queueSize = 0
+		}
+		client.questPool = newQuestWorkerPool(workers, queueSize, fullPolicy, client.questLimits)
+	}
+
+	if client.conn != nil {
+		client.conn.setQuestPool(client.questPool)
+	}
+}
+
+/*
+Limits the quests of the method being processed or waiting for a worker. limit <= 0 removes the limit.
+Only works when the quest worker pool is enabled.
+*/
+func (client *TCPClient) SetMethodConcurrency(method string, limit int) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if limit <= 0 {
+		delete(client.questLimits, method)
+	} else {
+		if client.questLimits == nil {
+			client.questLimits = make(map[string]int)
+		}
+		client.questLimits[method] = limit
+	}
+
+	if client.questPool != nil {
+		client.questPool.setMethodLimit(method, limit)
+	}
+}
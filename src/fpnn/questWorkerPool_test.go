@@ -0,0 +1,110 @@
+package fpnn
+
+import (
+	"testing"
+	"time"
+)
+
+type blockingProcessor struct {
+	release chan struct{}
+	started chan struct{}
+}
+
+func (processor *blockingProcessor) Process(method string) func(*Quest) (*Answer, error) {
+	return func(quest *Quest) (*Answer, error) {
+		if method == "slow" {
+			if processor.started != nil {
+				processor.started <- struct{}{}
+			}
+			<-processor.release
+		}
+		return NewAnswer(quest), nil
+	}
+}
+
+func pushTwoWayQuest(t *testing.T, server *testServer, method string, seqNum uint32) {
+	quest := NewQuest(method)
+	quest.seqNum = seqNum
+	server.pushQuest(t, quest)
+}
+
+func waitServerAnswer(t *testing.T, server *testServer) *Answer {
+	select {
+	case answer := <-server.answers:
+		return answer
+	case <-time.After(2 * time.Second):
+		t.Fatalf("wait answer from client timeout")
+	}
+	return nil
+}
+
+func TestQuestWorkerPoolRejectsWhenFull(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+	processor := &blockingProcessor{release: make(chan struct{})}
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetQuestProcessor(processor)
+	client.SetQuestWorkerPool(1, 0, QuestPoolFullReject)
+	defer client.Close()
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	pushTwoWayQuest(t, server, "slow", 1)
+	time.Sleep(100 * time.Millisecond)
+	pushTwoWayQuest(t, server, "slow", 2)
+
+	answer := waitServerAnswer(t, server)
+	if code, _ := answer.GetInt("code"); answer.SeqNum() != 2 || code != FPNN_EC_CORE_WORK_QUEUE_FULL {
+		t.Fatalf("expect work queue full answer for quest 2, seqNum: %d, code: %d", answer.SeqNum(), code)
+	}
+
+	//-- The slow handler doesn't stall the answers of the client's own quests.
+	if _, err := client.SendQuest(NewQuest("test"), 2*time.Second); err != nil {
+		t.Fatalf("send quest failed, err: %v", err)
+	}
+
+	close(processor.release)
+	if answer := waitServerAnswer(t, server); answer.SeqNum() != 1 || answer.IsException() {
+		t.Fatalf("unexpected answer for quest 1: %d %v", answer.SeqNum(), answer.data)
+	}
+}
+
+func TestQuestWorkerPoolMethodConcurrency(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+	processor := &blockingProcessor{release: make(chan struct{})}
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetQuestProcessor(processor)
+	client.SetQuestWorkerPool(4, 16, QuestPoolFullReject)
+	client.SetMethodConcurrency("slow", 1)
+	defer client.Close()
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	pushTwoWayQuest(t, server, "slow", 1)
+	time.Sleep(100 * time.Millisecond)
+	pushTwoWayQuest(t, server, "slow", 2)
+	pushTwoWayQuest(t, server, "fast", 3)
+
+	answers := map[uint32]*Answer{}
+	for i := 0; i < 2; i++ {
+		answer := waitServerAnswer(t, server)
+		answers[answer.SeqNum()] = answer
+	}
+
+	if code, _ := answers[2].GetInt("code"); code != FPNN_EC_CORE_WORK_QUEUE_FULL {
+		t.Fatalf("expect method limit rejection, code: %d", code)
+	}
+	if answers[3] == nil || answers[3].IsException() {
+		t.Fatalf("other method is blocked by the method limit")
+	}
+
+	close(processor.release)
+	waitServerAnswer(t, server)
+}
@@ -0,0 +1,325 @@
+package fpnn
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	ErrReconnectBackoff   = errors.New("Connection is invalid, reconnection is backing off.")
+	ErrReconnecting       = errors.New("Connection is invalid, reconnection is in progress.")
+	ErrReconnectExhausted = errors.New("Connection is invalid, reconnect attempts are exhausted.")
+)
+
+/*
+ReconnectPolicy controls how TCPClient redials after the connection is lost.
+
+	InitialDelay:	delay after the first failed attempt.
+	MaxDelay:		upper bound of the delay.
+	Multiplier:		factor applied to the delay after each failed attempt.
+	Jitter:			random spread of the delay, in [0, 1]. 0.2 means ±20%.
+	MaxAttempts:	failed attempts allowed before giving up. 0 means unlimited.
+	Proactive:		reconnect in background right after the connection is closed,
+					instead of waiting for the next send.
+*/
+type ReconnectPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	Jitter       float64
+	MaxAttempts  int
+	Proactive    bool
+}
+
+func NewReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		InitialDelay: 500 * time.Millisecond,
+		MaxDelay:     30 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+	}
+}
+
+func (policy *ReconnectPolicy) delay(failedAttempts int) time.Duration {
+	return backoffDelay(policy.InitialDelay, policy.MaxDelay, policy.Multiplier, policy.Jitter, failedAttempts)
+}
+
+func backoffDelay(initial time.Duration, max time.Duration, multiplier float64, jitter float64, times int) time.Duration {
+	if times <= 0 {
+		return 0
+	}
+
+	delay := float64(initial)
+	for i := 1; i < times; i++ {
+		delay *= multiplier
+		if max > 0 && delay >= float64(max) {
+			break
+		}
+	}
+
+	if max > 0 && delay > float64(max) {
+		delay = float64(max)
+	}
+
+	if jitter > 0 {
+		delay += delay * jitter * (2*rand.Float64() - 1)
+	}
+
+	if delay < 0 {
+		return 0
+	}
+	return time.Duration(delay)
+}
+
+func (policy *ReconnectPolicy) normalize() *ReconnectPolicy {
+	normalized := *policy
+	if normalized.InitialDelay <= 0 {
+		normalized.InitialDelay = 500 * time.Millisecond
+	}
+	if normalized.MaxDelay > 0 && normalized.MaxDelay < normalized.InitialDelay {
+		normalized.MaxDelay = normalized.InitialDelay
+	}
+	if normalized.Multiplier < 1 {
+		normalized.Multiplier = 1
+	}
+	if normalized.Jitter < 0 {
+		normalized.Jitter = 0
+	} else if normalized.Jitter > 1 {
+		normalized.Jitter = 1
+	}
+	if normalized.MaxAttempts < 0 {
+		normalized.MaxAttempts = 0
+	}
+	return &normalized
+}
+
+var defaultReconnectPolicy = NewReconnectPolicy()
+
+//-----------------[ reconnect state ]-----------------//
+
+type reconnectState struct {
+	mutex          sync.Mutex
+	failedAttempts int
+	nextDialTime   time.Time
+	loopRunning    bool
+	stopChan       chan struct{}
+}
+
+func (state *reconnectState) check(policy *ReconnectPolicy) error {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if policy.MaxAttempts > 0 && state.failedAttempts >= policy.MaxAttempts {
+		return ErrReconnectExhausted
+	}
+
+	if wait := time.Until(state.nextDialTime); wait > 0 {
+		return fmt.Errorf("%w Retry after %v.", ErrReconnectBackoff, wait.Round(time.Millisecond))
+	}
+	return nil
+}
+
+func (state *reconnectState) record(policy *ReconnectPolicy, ok bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if ok {
+		state.failedAttempts = 0
+		state.nextDialTime = time.Time{}
+	} else {
+		state.failedAttempts += 1
+		state.nextDialTime = time.Now().Add(policy.delay(state.failedAttempts))
+	}
+}
+
+func (state *reconnectState) reset() {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.failedAttempts = 0
+	state.nextDialTime = time.Time{}
+}
+
+// Returns the number of the next attempt and the time to wait, or false if attempts are exhausted.
+func (state *reconnectState) nextAttempt(policy *ReconnectPolicy) (int, time.Duration, bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if policy.MaxAttempts > 0 && state.failedAttempts >= policy.MaxAttempts {
+		return 0, 0, false
+	}
+
+	wait := time.Until(state.nextDialTime)
+	if wait < 0 {
+		wait = 0
+	}
+	return state.failedAttempts + 1, wait, true
+}
+
+func (state *reconnectState) waitTime() time.Duration {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	return time.Until(state.nextDialTime)
+}
+
+func (state *reconnectState) beginLoop() (chan struct{}, bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.loopRunning {
+		return nil, false
+	}
+
+	state.loopRunning = true
+	state.stopChan = make(chan struct{})
+	return state.stopChan, true
+}
+
+func (state *reconnectState) endLoop(stopChan chan struct{}) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.stopChan == stopChan {
+		state.loopRunning = false
+		state.stopChan = nil
+	}
+}
+
+func (state *reconnectState) stopLoop() {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.stopChan != nil {
+		close(state.stopChan)
+		state.stopChan = nil
+		state.loopRunning = false
+	}
+}
+
+//-----------------[ TCPClient reconnection ]-----------------//
+
+func (client *TCPClient) SetReconnectPolicy(policy *ReconnectPolicy) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if policy != nil {
+		client.reconnectPolicy = policy.normalize()
+	} else {
+		client.reconnectPolicy = nil
+	}
+	client.reconnect.reset()
+}
+
+func (client *TCPClient) getReconnectPolicy() *ReconnectPolicy {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.reconnectPolicy
+}
+
+func (client *TCPClient) reconnectWithPolicy(policy *ReconnectPolicy, waitDialing bool) error {
+
+	if policy == nil {
+		if client.Connect() {
+			return nil
+		}
+		return errors.New("Connection is invalid.")
+	}
+
+	if waitDialing {
+		client.connectMutex.Lock()
+	} else if !client.connectMutex.TryLock() {
+		return ErrReconnecting
+	}
+	defer client.connectMutex.Unlock()
+
+	if client.IsConnected() {
+		return nil
+	}
+
+	if err := client.reconnect.check(policy); err != nil {
+		return err
+	}
+
+	ok := client.realConnect()
+	client.reconnect.record(policy, ok)
+	if !ok {
+		client.emitReconnectScheduled(policy)
+		return errors.New("Connection is invalid.")
+	}
+	return nil
+}
+
+func (client *TCPClient) emitReconnectScheduled(policy *ReconnectPolicy) {
+	if attempt, delay, ok := client.reconnect.nextAttempt(policy); ok {
+		client.emitEvent(&ConnectionEvent{Type: ConnectionEventReconnectScheduled, Attempt: attempt, Delay: delay})
+	}
+}
+
+func (client *TCPClient) connectionClosed(conn *tcpConnection) {
+	client.mutex.Lock()
+	policy := client.reconnectPolicy
+	proactive := policy != nil && policy.Proactive && client.autoReconnect && !client.userClosed
+	if client.conn != conn {
+		proactive = false
+	}
+	client.mutex.Unlock()
+
+	if proactive {
+		client.emitReconnectScheduled(policy)
+		client.startReconnectLoop()
+	}
+}
+
+func (client *TCPClient) startReconnectLoop() {
+	stopChan, ok := client.reconnect.beginLoop()
+	if ok {
+		client.routines.start(func() {
+			client.reconnectLoop(stopChan)
+		})
+	}
+}
+
+func (client *TCPClient) reconnectLoop(stopChan chan struct{}) {
+
+	defer client.reconnect.endLoop(stopChan)
+
+	for {
+		if wait := client.reconnect.waitTime(); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-stopChan:
+				timer.Stop()
+				return
+			}
+		}
+
+		client.mutex.Lock()
+		stop := client.userClosed || !client.autoReconnect
+		policy := client.reconnectPolicy
+		client.mutex.Unlock()
+
+		if stop || client.IsConnected() {
+			return
+		}
+
+		if policy == nil {
+			policy = defaultReconnectPolicy
+		}
+
+		err := client.reconnectWithPolicy(policy, true)
+		if err == nil {
+			return
+		}
+
+		if errors.Is(err, ErrReconnectExhausted) {
+			client.offlineQueue.failAll(FPNN_EC_CORE_CONNECTION_CLOSED, "Reconnect attempts are exhausted.")
+			return
+		}
+	}
+}
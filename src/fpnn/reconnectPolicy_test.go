@@ -0,0 +1,95 @@
+package fpnn
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func closedEndpoint(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	endpoint := listener.Addr().String()
+	listener.Close()
+	return endpoint
+}
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	policy := (&ReconnectPolicy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 2}).normalize()
+
+	expected := []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond,
+		800 * time.Millisecond, time.Second, time.Second}
+	for attempts, delay := range expected {
+		if got := policy.delay(attempts); got != delay {
+			t.Fatalf("delay for %d failed attempts: got %v, want %v", attempts, got, delay)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.delay(2); got < 100*time.Millisecond || got > 300*time.Millisecond {
+			t.Fatalf("jittered delay out of range: %v", got)
+		}
+	}
+}
+
+func TestReconnectBackoffFailsFast(t *testing.T) {
+	client := NewTCPClient(closedEndpoint(t))
+	client.SetLogger(testLogger)
+	client.SetReconnectPolicy(&ReconnectPolicy{InitialDelay: time.Hour, MaxAttempts: 2})
+	defer client.Close()
+
+	if _, err := client.SendQuest(NewQuest("test")); err == nil || errors.Is(err, ErrReconnectBackoff) {
+		t.Fatalf("first send should dial and fail, err: %v", err)
+	}
+
+	start := time.Now()
+	if _, err := client.SendQuest(NewQuest("test")); !errors.Is(err, ErrReconnectBackoff) {
+		t.Fatalf("send during backoff should fail fast, err: %v", err)
+	}
+	if cost := time.Since(start); cost > 100*time.Millisecond {
+		t.Fatalf("send during backoff blocked for %v", cost)
+	}
+}
+
+func TestReconnectAttemptsExhausted(t *testing.T) {
+	client := NewTCPClient(closedEndpoint(t))
+	client.SetLogger(testLogger)
+	client.SetReconnectPolicy(&ReconnectPolicy{InitialDelay: time.Millisecond, MaxAttempts: 2})
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		client.SendQuest(NewQuest("test"))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, err := client.SendQuest(NewQuest("test")); !errors.Is(err, ErrReconnectExhausted) {
+		t.Fatalf("expect exhausted error, err: %v", err)
+	}
+}
+
+func TestProactiveReconnect(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetReconnectPolicy(&ReconnectPolicy{InitialDelay: 10 * time.Millisecond, Proactive: true})
+	defer client.Close()
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	server.dropConnections()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for server.acceptedCount() < 2 || !client.IsConnected() {
+		if time.Now().After(deadline) {
+			t.Fatalf("client did not reconnect proactively, accepted: %d", server.acceptedCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
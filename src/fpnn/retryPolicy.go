@@ -0,0 +1,188 @@
+package fpnn
+
+import (
+	"errors"
+	"time"
+)
+
+/*
+RetryPolicy declares how a two-way quest of an idempotent method is retried.
+The quest timeout is the deadline of all attempts, shared by the remaining attempts.
+
+	MaxAttempts:			total attempts, including the first one.
+	RetryableErrorCodes:	error codes to retry. Empty means FPNN_EC_CORE_TIMEOUT & FPNN_EC_CORE_CONNECTION_CLOSED.
+	InitialBackoff:			delay before the first retry.
+	MaxBackoff:				upper bound of the delay. 0 means no limit.
+	Multiplier:				factor applied to the delay after each retry.
+	Budget:					overall deadline of all attempts. 0 means the quest timeout only.
+	Idempotent:				must be true, otherwise the policy is ignored.
+*/
+type RetryPolicy struct {
+	MaxAttempts         int
+	RetryableErrorCodes []int
+	InitialBackoff      time.Duration
+	MaxBackoff          time.Duration
+	Multiplier          float64
+	Budget              time.Duration
+	Idempotent          bool
+}
+
+func (policy *RetryPolicy) normalize() *RetryPolicy {
+	normalized := *policy
+	if len(normalized.RetryableErrorCodes) == 0 {
+		normalized.RetryableErrorCodes = []int{FPNN_EC_CORE_TIMEOUT, FPNN_EC_CORE_CONNECTION_CLOSED}
+	} else {
+		normalized.RetryableErrorCodes = append([]int(nil), policy.RetryableErrorCodes...)
+	}
+	if normalized.InitialBackoff < 0 {
+		normalized.InitialBackoff = 0
+	}
+	if normalized.Multiplier < 1 {
+		normalized.Multiplier = 1
+	}
+	return &normalized
+}
+
+func (policy *RetryPolicy) isRetryable(errorCode int) bool {
+	for _, code := range policy.RetryableErrorCodes {
+		if code == errorCode {
+			return true
+		}
+	}
+	return false
+}
+
+//-----------------[ retrying quest ]-----------------//
+
+type retryingQuest struct {
+	client   *TCPClient
+	quest    *Quest
+	callback *connCallback
+	policy   *RetryPolicy
+	attempts int
+	deadline time.Time
+}
+
+// The remaining time is shared by the remaining attempts.
+func (rq *retryingQuest) send() error {
+	timeout := time.Until(rq.deadline) / time.Duration(rq.policy.MaxAttempts-rq.attempts)
+
+	cb := &connCallback{}
+	cb.deadline = time.Now().Add(timeout)
+	cb.callbackFunc = rq.onAnswer
+
+	rq.attempts += 1
+	return rq.client.sendQuestAttempt(rq.quest, cb)
+}
+
+func (rq *retryingQuest) onAnswer(answer *Answer, errorCode int) {
+
+	if rq.retry(errorCode) {
+		return
+	}
+
+	callAnswerCallback(answer, rq.callback)
+}
+
+func (rq *retryingQuest) retry(errorCode int) bool {
+
+	if rq.attempts >= rq.policy.MaxAttempts || !rq.policy.isRetryable(errorCode) || rq.quest.handle.isCancelled() {
+		return false
+	}
+
+	backoff := backoffDelay(rq.policy.InitialBackoff, rq.policy.MaxBackoff, rq.policy.Multiplier, 0, rq.attempts)
+	if !time.Now().Add(backoff).Before(rq.deadline) {
+		return false
+	}
+
+	rq.client.routines.afterFunc(backoff, func() {
+		//-- Fired at once by Close(). Sending would reconnect the closed client.
+		if rq.client.isClosed() {
+			answer := newErrorAnswerWitSeqNum(rq.quest.seqNum, FPNN_EC_CORE_CONNECTION_CLOSED, "Connection is closed.")
+			executeAnswerCallback(rq.client.getCallbackExecutor(), answer, rq.callback)
+			return
+		}
+
+		if err := rq.send(); err != nil {
+			errorCode := sendErrorCode(err)
+			if isTransportError(err) && rq.retry(errorCode) {
+				return
+			}
+
+			answer := newErrorAnswerWitSeqNum(rq.quest.seqNum, errorCode, err.Error())
+			executeAnswerCallback(rq.client.getCallbackExecutor(), answer, rq.callback)
+		}
+	})
+	return true
+}
+
+// Errors not caused by the connection. Retrying them does not help.
+func isTransportError(err error) bool {
+	var breakerErr *CircuitBreakerOpenError
+	switch {
+	case errors.As(err, &breakerErr),
+		errors.Is(err, ErrQuestCancelled),
+		errors.Is(err, ErrClientShutdown),
+		errors.Is(err, ErrClientClosed),
+		errors.Is(err, ErrReconnectExhausted):
+		return false
+	}
+	return true
+}
+
+func sendErrorCode(err error) int {
+	if errors.Is(err, ErrQuestCancelled) {
+		return FPNN_EC_SDK_QUEST_CANCELLED
+	}
+	if isTransportError(err) {
+		return FPNN_EC_CORE_CONNECTION_CLOSED
+	}
+	return FPNN_EC_CORE_SEND_ERROR
+}
+
+//-----------------[ TCPClient retry policies ]-----------------//
+
+/*
+Retries never apply to one-way quests, or to methods whose policy is not marked Idempotent.
+Set nil policy to remove the retry policy of the method.
+*/
+func (client *TCPClient) SetRetryPolicy(method string, policy *RetryPolicy) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if policy == nil || !policy.Idempotent || policy.MaxAttempts <= 1 {
+		delete(client.retryPolicies, method)
+		return
+	}
+
+	if client.retryPolicies == nil {
+		client.retryPolicies = make(map[string]*RetryPolicy)
+	}
+	client.retryPolicies[method] = policy.normalize()
+}
+
+func (client *TCPClient) getRetryPolicy(method string) *RetryPolicy {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.retryPolicies[method]
+}
+
+func (client *TCPClient) sendQuestWithRetry(quest *Quest, cb *connCallback, policy *RetryPolicy) error {
+
+	rq := &retryingQuest{
+		client:   client,
+		quest:    quest,
+		callback: cb,
+		policy:   policy,
+		deadline: cb.deadline,
+	}
+
+	if policy.Budget > 0 {
+		if deadline := time.Now().Add(policy.Budget); deadline.Before(rq.deadline) {
+			rq.deadline = deadline
+		}
+	}
+
+	return rq.send()
+}
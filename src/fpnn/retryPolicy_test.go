@@ -0,0 +1,134 @@
+package fpnn
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	var received int32
+	server := newTestServer(t, func(quest *Quest) *Answer {
+		if atomic.AddInt32(&received, 1)%3 != 0 {
+			return NewErrorAnswer(quest, FPNN_EC_CORE_WORK_QUEUE_FULL, "busy")
+		}
+		return NewAnswer(quest)
+	})
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	defer client.Close()
+
+	policy := &RetryPolicy{
+		MaxAttempts:         3,
+		RetryableErrorCodes: []int{FPNN_EC_CORE_WORK_QUEUE_FULL},
+		InitialBackoff:      10 * time.Millisecond,
+		Idempotent:          true,
+	}
+
+	client.SetRetryPolicy("read", policy)
+	answer, err := client.SendQuest(NewQuest("read"))
+	if err != nil || answer.IsException() {
+		t.Fatalf("quest should succeed after retries, answer: %v, err: %v", answer, err)
+	}
+	if count := atomic.LoadInt32(&received); count != 3 {
+		t.Fatalf("expect 3 attempts, got %d", count)
+	}
+
+	codeChan := make(chan int, 1)
+	client.SendQuestWithLambda(NewQuest("write"), func(answer *Answer, errorCode int) {
+		codeChan <- errorCode
+	})
+	if code := <-codeChan; code != FPNN_EC_CORE_WORK_QUEUE_FULL {
+		t.Fatalf("quest without retry policy should fail, errorCode: %d", code)
+	}
+
+	policy.Idempotent = false
+	client.SetRetryPolicy("write", policy)
+	client.SendQuestWithLambda(NewQuest("write"), func(answer *Answer, errorCode int) {
+		codeChan <- errorCode
+	})
+	if code := <-codeChan; code != FPNN_EC_CORE_WORK_QUEUE_FULL {
+		t.Fatalf("non-idempotent method should not be retried, errorCode: %d", code)
+	}
+	if count := atomic.LoadInt32(&received); count != 5 {
+		t.Fatalf("expect 5 quests received, got %d", count)
+	}
+}
+
+func TestRetryStopsWhenClientClosed(t *testing.T) {
+	server := newTestServer(t, func(quest *Quest) *Answer {
+		return NewErrorAnswer(quest, FPNN_EC_CORE_WORK_QUEUE_FULL, "busy")
+	})
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetRetryPolicy("read", &RetryPolicy{
+		MaxAttempts:         3,
+		RetryableErrorCodes: []int{FPNN_EC_CORE_WORK_QUEUE_FULL},
+		InitialBackoff:      time.Hour,
+		Idempotent:          true,
+	})
+
+	codeChan := make(chan int, 1)
+	client.SendQuestWithLambda(NewQuest("read"), func(answer *Answer, errorCode int) {
+		codeChan <- errorCode
+	}, 2*time.Hour)
+
+	//-- The first attempt fails, and the retry is scheduled.
+	time.Sleep(200 * time.Millisecond)
+	client.Close()
+
+	select {
+	case code := <-codeChan:
+		if code != FPNN_EC_CORE_CONNECTION_CLOSED {
+			t.Fatalf("unexpected error code: %d", code)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("retrying quest is not completed after close")
+	}
+	if client.IsConnected() {
+		t.Fatalf("closed client is reconnected by retrying")
+	}
+}
+
+func TestNonTransportErrorsAreNotRetried(t *testing.T) {
+	for _, err := range []error{&CircuitBreakerOpenError{}, ErrQuestCancelled, ErrClientShutdown, ErrReconnectExhausted} {
+		if isTransportError(err) {
+			t.Fatalf("%v should not be retried", err)
+		}
+	}
+	if !isTransportError(ErrWriteQueueFull) {
+		t.Fatalf("write queue full should be retried")
+	}
+	if code := sendErrorCode(ErrQuestCancelled); code != FPNN_EC_SDK_QUEST_CANCELLED {
+		t.Fatalf("unexpected error code of cancelled quest: %d", code)
+	}
+}
+
+func TestRetryKeepsQuestTimeout(t *testing.T) {
+	server := newTestServer(t, func(quest *Quest) *Answer {
+		return nil
+	})
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	defer client.Close()
+
+	client.SetRetryPolicy("read", &RetryPolicy{
+		MaxAttempts: 2,
+		Idempotent:  true,
+	})
+
+	start := time.Now()
+	answer, err := client.SendQuest(NewQuest("read"), 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("send quest failed: %v", err)
+	}
+	if code, _ := answer.GetInt("code"); code != FPNN_EC_CORE_TIMEOUT {
+		t.Fatalf("quest should time out, answer: %v", answer)
+	}
+	if elapsed := time.Since(start); elapsed > 1500*time.Millisecond {
+		t.Fatalf("retries exceed the quest timeout, elapsed: %v", elapsed)
+	}
+}
@@ -0,0 +1,122 @@
+package fpnn
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrClientShutdown = errors.New("Client is shutting down.")
+
+//-----------------[ tcpConnection draining ]-----------------//
+
+func (conn *tcpConnection) isDraining() bool {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	return conn.draining
+}
+
+// Waits for the answers of all sent quests, then writes all queued frames.
+func (conn *tcpConnection) drain(ctx context.Context) error {
+	conn.mutex.Lock()
+	conn.draining = true
+	conn.mutex.Unlock()
+
+	if err := conn.waitAnswers(ctx); err != nil {
+		return err
+	}
+	return conn.flushWriteQueue(ctx)
+}
+
+// Called with conn.mutex locked, after callbacks are removed from answerMap.
+func (conn *tcpConnection) notifyAnswersDrained() {
+	if conn.answersDrained != nil && len(conn.answerMap) == 0 {
+		close(conn.answersDrained)
+		conn.answersDrained = nil
+	}
+}
+
+func (conn *tcpConnection) waitAnswers(ctx context.Context) error {
+	for {
+		conn.mutex.Lock()
+		if !conn.connected {
+			conn.mutex.Unlock()
+			return errors.New("Connection is broken.")
+		}
+		if len(conn.answerMap) == 0 {
+			conn.mutex.Unlock()
+			return nil
+		}
+
+		if conn.answersDrained == nil {
+			conn.answersDrained = make(chan struct{})
+		}
+		drained := conn.answersDrained
+		conn.mutex.Unlock()
+
+		select {
+		case <-drained:
+		case <-conn.closedChan:
+			return errors.New("Connection is broken.")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (conn *tcpConnection) flushWriteQueue(ctx context.Context) error {
+	flushed := make(chan struct{})
+
+	select {
+	case conn.writeChan <- writeFrame{flushed: flushed}:
+	case <-conn.closedChan:
+		return errors.New("Connection is broken.")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-conn.closedChan:
+		return errors.New("Connection is broken.")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//-----------------[ TCPClient shutdown ]-----------------//
+
+func (client *TCPClient) isShuttingDown() bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.shuttingDown
+}
+
+/*
+Shutdown stops accepting new sends, which return ErrClientShutdown, and fails the quests in the offline queue.
+Then it waits for the answers of the sent quests, writes the queued data, and closes the client.
+
+If ctx is done before that, the client is closed immediately, the pending quests fail with
+FPNN_EC_CORE_CONNECTION_CLOSED, and ctx.Err() is returned.
+
+Call Connect() to use the client again.
+*/
+func (client *TCPClient) Shutdown(ctx context.Context) error {
+	client.mutex.Lock()
+	client.shuttingDown = true
+	conn := client.conn
+	client.mutex.Unlock()
+
+	client.reconnect.stopLoop()
+	client.offlineQueue.failAll(FPNN_EC_CORE_CONNECTION_CLOSED, "Client is shutting down.")
+
+	var err error
+	if conn != nil && conn.isConnected() {
+		err = conn.drain(ctx)
+	}
+
+	client.Close()
+	return err
+}
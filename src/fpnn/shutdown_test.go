@@ -0,0 +1,123 @@
+package fpnn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newDelayedServer(t *testing.T, delay time.Duration, oneWays chan string) *testServer {
+	return newTestServer(t, func(quest *Quest) *Answer {
+		if !quest.IsTwoWay() {
+			oneWays <- quest.Method()
+			return nil
+		}
+
+		time.Sleep(delay)
+		return echoHandler(quest)
+	})
+}
+
+func TestShutdownDrainsQuests(t *testing.T) {
+	oneWays := make(chan string, 4)
+	server := newDelayedServer(t, 300*time.Millisecond, oneWays)
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	defer client.Close()
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	codes := make(chan int, 1)
+	client.SendQuestWithLambda(NewQuest("slow"), func(answer *Answer, errorCode int) {
+		codes <- errorCode
+	})
+	if _, err := client.SendQuest(NewOneWayQuest("notify")); err != nil {
+		t.Fatalf("send one way quest failed, err: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		done <- client.Shutdown(ctx)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for !client.isShuttingDown() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := client.SendQuest(NewQuest("late")); !errors.Is(err, ErrClientShutdown) {
+		t.Fatalf("send quest during shutdown returns: %v", err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("shutdown failed, err: %v", err)
+	}
+	if code := <-codes; code != FPNN_EC_OK {
+		t.Fatalf("pending quest failed with code %d", code)
+	}
+	if method := <-oneWays; method != "notify" {
+		t.Fatalf("unexpected one way quest: %s", method)
+	}
+	if client.IsConnected() {
+		t.Fatalf("client is connected after shutdown")
+	}
+
+	if !client.Connect() {
+		t.Fatalf("connect after shutdown failed")
+	}
+	if _, err := client.SendQuest(NewOneWayQuest("again")); err != nil {
+		t.Fatalf("send quest after reconnecting failed, err: %v", err)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	server := newDelayedServer(t, 2*time.Second, make(chan string, 1))
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	defer client.Close()
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	codes := make(chan int, 1)
+	client.SendQuestWithLambda(NewQuest("slow"), func(answer *Answer, errorCode int) {
+		codes <- errorCode
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := client.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected shutdown result: %v", err)
+	}
+	if code := <-codes; code != FPNN_EC_CORE_CONNECTION_CLOSED {
+		t.Fatalf("pending quest is completed with code %d", code)
+	}
+}
+
+func TestShutdownRejectsRetriedAttempts(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	defer client.Close()
+
+	if err := client.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed, err: %v", err)
+	}
+
+	//-- Retried and hedged attempts skip realSendQuest().
+	if err := client.sendQuestAttempt(NewOneWayQuest("late"), nil); !errors.Is(err, ErrClientShutdown) {
+		t.Fatalf("attempt during shutdown returns: %v", err)
+	}
+	if client.IsConnected() {
+		t.Fatalf("client is reconnected by the attempt")
+	}
+}
@@ -0,0 +1,207 @@
+package fpnn
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Quests counters of one method. Answered includes the error answers returned by the server.
+Failed counts the quests completed without an answer, e.g. the connection is closed or the quest is cancelled.
+*/
+type MethodStats struct {
+	Sent     int64
+	Answered int64
+	TimedOut int64
+	Failed   int64
+}
+
+/*
+Snapshot of the statistics of a client.
+Counters are accumulated over all connections of the client.
+InFlightQuests, WriteQueueDepth and ConnectionUptime are taken from the current connection, and are 0 if it is not connected.
+*/
+type ClientStats struct {
+	InFlightQuests   int
+	WriteQueueDepth  int
+	BytesSent        int64
+	BytesReceived    int64
+	FramesSent       int64
+	FramesReceived   int64
+	QuestsSent       int64
+	QuestsAnswered   int64
+	QuestsTimedOut   int64
+	QuestsFailed     int64
+	Methods          map[string]MethodStats
+	ReconnectCount   int64
+	LastKeepAliveRTT time.Duration
+	ConnectionUptime time.Duration
+}
+
+type methodCounters struct {
+	sent     int64
+	answered int64
+	timedOut int64
+	failed   int64
+}
+
+type clientStats struct {
+	bytesSent      int64
+	bytesReceived  int64
+	framesSent     int64
+	framesReceived int64
+	connects       int64
+	keepAliveRTT   int64
+	inFlight       int64
+	methods        sync.Map
+	target         atomic.Value
+	clientId       uint64
+}
+
+func (stats *clientStats) method(method string) *methodCounters {
+	if counters, ok := stats.methods.Load(method); ok {
+		return counters.(*methodCounters)
+	}
+
+	counters, _ := stats.methods.LoadOrStore(method, &methodCounters{})
+	return counters.(*methodCounters)
+}
+
+//-- All recording functions accept nil stats, for connections created without a client.
+
+func (stats *clientStats) recordSent(bytes int, frames int) {
+	if stats != nil {
+		atomic.AddInt64(&stats.bytesSent, int64(bytes))
+		atomic.AddInt64(&stats.framesSent, int64(frames))
+	}
+}
+
+func (stats *clientStats) recordReceived(bytes int) {
+	if stats != nil {
+		atomic.AddInt64(&stats.bytesReceived, int64(bytes))
+		atomic.AddInt64(&stats.framesReceived, 1)
+	}
+}
+
+func (stats *clientStats) questSent(method string, twoWay bool) {
+	if stats == nil {
+		return
+	}
+
+	atomic.AddInt64(&stats.method(method).sent, 1)
+	if twoWay {
+		atomic.AddInt64(&stats.inFlight, 1)
+	}
+	stats.reportQuestSent(method, twoWay)
+}
+
+func (stats *clientStats) questCompleted(cb *connCallback, errorCode int) {
+	if stats == nil {
+		return
+	}
+
+	atomic.AddInt64(&stats.inFlight, -1)
+	defer stats.reportQuestCompleted(cb, errorCode)
+
+	counters := stats.method(cb.method)
+	switch errorCode {
+	case FPNN_EC_CORE_TIMEOUT:
+		atomic.AddInt64(&counters.timedOut, 1)
+	case FPNN_EC_CORE_CONNECTION_CLOSED, FPNN_EC_SDK_QUEST_CANCELLED:
+		atomic.AddInt64(&counters.failed, 1)
+	default:
+		atomic.AddInt64(&counters.answered, 1)
+	}
+}
+
+func (stats *clientStats) connected() {
+	if stats != nil {
+		stats.reportConnectionChanged(true, atomic.AddInt64(&stats.connects, 1))
+	}
+}
+
+func (stats *clientStats) disconnected() {
+	if stats != nil {
+		stats.reportConnectionChanged(false, 0)
+	}
+}
+
+func (stats *clientStats) handshake(handshakeType string, succeeded bool, cost time.Duration) {
+	if stats != nil {
+		stats.reportHandshake(handshakeType, succeeded, cost)
+	}
+}
+
+func (stats *clientStats) setKeepAliveRTT(rtt time.Duration) {
+	if stats != nil {
+		atomic.StoreInt64(&stats.keepAliveRTT, int64(rtt))
+	}
+}
+
+func (stats *clientStats) snapshot() ClientStats {
+	result := ClientStats{}
+	result.BytesSent = atomic.LoadInt64(&stats.bytesSent)
+	result.BytesReceived = atomic.LoadInt64(&stats.bytesReceived)
+	result.FramesSent = atomic.LoadInt64(&stats.framesSent)
+	result.FramesReceived = atomic.LoadInt64(&stats.framesReceived)
+	result.LastKeepAliveRTT = time.Duration(atomic.LoadInt64(&stats.keepAliveRTT))
+
+	if connects := atomic.LoadInt64(&stats.connects); connects > 1 {
+		result.ReconnectCount = connects - 1
+	}
+
+	result.Methods = make(map[string]MethodStats)
+	stats.methods.Range(func(key, value interface{}) bool {
+		counters := value.(*methodCounters)
+		methodStats := MethodStats{
+			Sent:     atomic.LoadInt64(&counters.sent),
+			Answered: atomic.LoadInt64(&counters.answered),
+			TimedOut: atomic.LoadInt64(&counters.timedOut),
+			Failed:   atomic.LoadInt64(&counters.failed),
+		}
+
+		result.Methods[key.(string)] = methodStats
+		result.QuestsSent += methodStats.Sent
+		result.QuestsAnswered += methodStats.Answered
+		result.QuestsTimedOut += methodStats.TimedOut
+		result.QuestsFailed += methodStats.Failed
+		return true
+	})
+
+	return result
+}
+
+//-----------------[ tcpConnection stats ]-----------------//
+
+func (conn *tcpConnection) fillStats(stats *ClientStats) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	if !conn.connected {
+		return
+	}
+
+	stats.InFlightQuests = len(conn.answerMap)
+	stats.WriteQueueDepth = len(conn.writeChan)
+	stats.ConnectionUptime = time.Since(conn.connectedTime)
+}
+
+//-----------------[ TCPClient stats ]-----------------//
+
+/*
+Returns a snapshot of the statistics of the client.
+The internal quests, such as keep alive pings, are included in Methods.
+*/
+func (client *TCPClient) Stats() ClientStats {
+	stats := client.stats.snapshot()
+
+	client.mutex.Lock()
+	conn := client.conn
+	client.mutex.Unlock()
+
+	if conn != nil {
+		conn.fillStats(&stats)
+	}
+	return stats
+}
@@ -0,0 +1,83 @@
+package fpnn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClientStats(t *testing.T) {
+	server := newTestServer(t, func(quest *Quest) *Answer {
+		switch quest.Method() {
+		case "silent":
+			return nil
+		case "fail":
+			return NewErrorAnswer(quest, FPNN_EC_CORE_FORBIDDEN, "forbidden")
+		}
+		return echoHandler(quest)
+	})
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetKeepAlive(true)
+	client.SetKeepAliveIntervalSecond(100 * time.Millisecond)
+	defer client.Close()
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.SendQuest(NewQuest("echo")); err != nil {
+			t.Fatalf("send quest failed, err: %v", err)
+		}
+	}
+	client.SendQuest(NewQuest("fail"))
+	client.SendQuest(NewQuest("silent"), time.Second)
+
+	failed := make(chan int, 1)
+	client.SendQuestWithLambda(NewQuest("silent"), func(answer *Answer, errorCode int) {
+		failed <- errorCode
+	}, 10*time.Second)
+
+	stats := client.Stats()
+	if stats.InFlightQuests < 1 || stats.ConnectionUptime <= 0 {
+		t.Fatalf("unexpected connection stats: %+v", stats)
+	}
+
+	server.dropConnections()
+	if code := <-failed; code != FPNN_EC_CORE_CONNECTION_CLOSED {
+		t.Fatalf("unexpected error code: %d", code)
+	}
+
+	if !client.Connect() {
+		t.Fatalf("reconnect failed")
+	}
+
+	stats = client.Stats()
+	if echo := stats.Methods["echo"]; echo.Sent != 2 || echo.Answered != 2 {
+		t.Fatalf("unexpected echo stats: %+v", echo)
+	}
+	if fail := stats.Methods["fail"]; fail.Sent != 1 || fail.Answered != 1 {
+		t.Fatalf("unexpected fail stats: %+v", fail)
+	}
+	if silent := stats.Methods["silent"]; silent.Sent != 2 || silent.TimedOut != 1 || silent.Failed != 1 {
+		t.Fatalf("unexpected silent stats: %+v", silent)
+	}
+	if stats.ReconnectCount != 1 || stats.InFlightQuests != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats.QuestsSent < 5 || stats.FramesSent < stats.QuestsSent || stats.FramesReceived < 3 {
+		t.Fatalf("unexpected totals: %+v", stats)
+	}
+	if stats.BytesSent < 12*stats.FramesSent || stats.BytesReceived < 12*stats.FramesReceived {
+		t.Fatalf("unexpected bytes: %+v", stats)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for client.Stats().LastKeepAliveRTT == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("keep alive RTT is not recorded")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
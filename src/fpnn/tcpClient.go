@@ -2,7 +2,6 @@ package fpnn
 
 import (
 	"errors"
-	"runtime"
 	"sync"
 	"time"
 )
@@ -11,6 +10,8 @@ const (
 	SDKVersion = "1.1.2"
 )
 
+var ErrClientClosed = errors.New("Client is closed.")
+
 type AnswerCallback interface {
 	OnAnswer(answer *Answer)
 	OnException(answer *Answer, errorCode int)
@@ -31,6 +32,7 @@ type tcpClientCloseCallback func(connId uint64, endpoint string)
 
 type TCPClient struct {
 	mutex           sync.Mutex
+	connectMutex    sync.Mutex
 	autoReconnect   bool
 	endpoint        string
 	timeout         time.Duration
@@ -41,84 +43,158 @@ type TCPClient struct {
 	serverKey       *eccPublicKeyInfo
 	onConnected     tcpClientConnectedCallback
 	onClosed        tcpClientCloseCallback
+	onConnectedInfo func(info *ConnectionInfo, connected bool)
+	onClosedInfo    func(info *ConnectionInfo)
 	logger          Logger
 	keepAliveParams *KeepAliveParams
+	reconnectPolicy *ReconnectPolicy
+	reconnect       reconnectState
+	offlineQueue    offlineQueue
+	retryPolicies   map[string]*RetryPolicy
+	hedgePolicies   map[string]*hedgeState
+	breaker         *circuitBreaker
+	flowController  *flowController
+	flowControllers map[string]*flowController
+	breakerCallback circuitBreakerStateChangedCallback
+	userClosed      bool
+	trySend         bool
+	writeBatch      *writeBatchParams
+	executor        CallbackExecutor
+	orderedAnswers  bool
+	questPool       *questWorkerPool
+	questLimits     map[string]int
+	interceptors    []QuestInterceptor
+	middlewares     []QuestMiddleware
+	stats           clientStats
+	tracing         *tracingConfig
+	leveledLogger   LeveledLogger
+	listener        ConnectionEventListener
+	eventQueue      *serialExecutor
+	shuttingDown    bool
+	routines        goroutineGroup
+	options         clientOptions
 }
 
 func NewTCPClient(endpoint string) *TCPClient {
-
-	client := &TCPClient{}
-
-	client.autoReconnect = true
-	client.endpoint = endpoint
-	client.timeout = Config.questTimeout
-	client.connectTimeout = Config.connectTimeout
-	runtime.SetFinalizer(client, closeTCPClient)
-	return client
-}
-
-func closeTCPClient(client *TCPClient) {
-	go client.Close()
+	return NewTCPClientWithOptions(endpoint)
 }
 
 func (client *TCPClient) SetAutoReconnect(autoReconnect bool) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
 	client.autoReconnect = autoReconnect
 }
 
 func (client *TCPClient) SetKeepAlive(keepAlive bool) {
 	if keepAlive {
-		client.mutex.Lock()
-		if client.keepAliveParams == nil {
-			param := new(KeepAliveParams)
-			client.keepAliveParams = param
-			client.keepAliveParams.pingInterval = Config.pingInterval
-			client.keepAliveParams.maxPingRetryCount = Config.maxPingRetryCount
-			client.keepAliveParams.pingTimeout = Config.questTimeout
-		}
-		client.mutex.Unlock()
+		client.updateKeepAliveParams(func(params *KeepAliveParams) {})
+	}
+}
+
+// The params are copied on writing, so the connections can use the old params without locking.
+func (client *TCPClient) updateKeepAliveParams(update func(params *KeepAliveParams)) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	params := &KeepAliveParams{
+		pingInterval:      Config.pingInterval,
+		maxPingRetryCount: Config.maxPingRetryCount,
+		pingTimeout:       Config.questTimeout,
 	}
+	if client.keepAliveParams != nil {
+		*params = *client.keepAliveParams
+	}
+
+	update(params)
+	client.keepAliveParams = params
 }
 
 func (client *TCPClient) SetKeepAliveTimeoutSecond(second time.Duration) {
-	client.SetKeepAlive(true)
-	client.keepAliveParams.pingTimeout = second
+	client.updateKeepAliveParams(func(params *KeepAliveParams) {
+		params.pingTimeout = second
+	})
 }
 
 func (client *TCPClient) SetKeepAliveIntervalSecond(second time.Duration) {
-	client.SetKeepAlive(true)
-	client.keepAliveParams.pingInterval = second
+	client.updateKeepAliveParams(func(params *KeepAliveParams) {
+		params.pingInterval = second
+	})
 }
 
 func (client *TCPClient) SetKeepAliveMaxPingRetryCount(count int) {
-	client.SetKeepAlive(true)
-	client.keepAliveParams.maxPingRetryCount = count
+	client.updateKeepAliveParams(func(params *KeepAliveParams) {
+		params.maxPingRetryCount = count
+	})
 }
 
 func (client *TCPClient) GetAutoReconnect() bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
 	return client.autoReconnect
 }
 
 func (client *TCPClient) SetConnectTimeOut(timeout time.Duration) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
 	client.connectTimeout = timeout
 }
 
 func (client *TCPClient) SetQuestTimeOut(timeout time.Duration) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
 	client.timeout = timeout
 }
 
+func (client *TCPClient) defaultQuestTimeout() time.Duration {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.timeout
+}
+
+/*
+In try-send mode, sending returns ErrWriteQueueFull immediately if the write queue of the connection is full,
+instead of waiting for the queue to be drained.
+*/
+func (client *TCPClient) SetTrySendMode(trySend bool) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.trySend = trySend
+	if client.conn != nil {
+		client.conn.setTrySend(trySend)
+	}
+}
+
 func (client *TCPClient) SetQuestProcessor(questProcessor QuestProcessor) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
 	client.questProcessor = questProcessor
 }
 
 func (client *TCPClient) SetOnConnectedCallback(onConnected tcpClientConnectedCallback) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
 	client.onConnected = onConnected
 }
 
 func (client *TCPClient) SetOnClosedCallback(onClosed tcpClientCloseCallback) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
 	client.onClosed = onClosed
 }
 
 func (client *TCPClient) SetLogger(logger Logger) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
 	client.logger = logger
 }
 
@@ -149,10 +225,11 @@ func (client *TCPClient) EnableEncryptor(rest ...interface{}) (err error) {
 		}
 	}
 
+	var serverKey *eccPublicKeyInfo
 	if rawPemData != nil {
-		client.serverKey, err = extraEccPublicKeyFromPemData(rawPemData)
+		serverKey, err = extraEccPublicKeyFromPemData(rawPemData)
 	} else if len(pemPath) > 0 {
-		client.serverKey, err = loadEccPublicKeyFromPemFile(pemPath)
+		serverKey, err = loadEccPublicKeyFromPemFile(pemPath)
 	} else {
 		return errors.New("Invaild params with FPNN.TCPClient.EnableEncryptor(), both pemPath & rawPemData are empty.")
 	}
@@ -161,6 +238,10 @@ func (client *TCPClient) EnableEncryptor(rest ...interface{}) (err error) {
 		return err
 	}
 
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.serverKey = serverKey
 	if reinforce {
 		client.aesKeyBits = 256
 	} else {
@@ -182,29 +263,107 @@ func (client *TCPClient) IsConnected() bool {
 	}
 }
 
+func (client *TCPClient) activeLogger() Logger {
+	client.mutex.Lock()
+	logger := client.logger
+	client.mutex.Unlock()
+
+	if logger != nil {
+		return logger
+	}
+	return client.options.logger
+}
+
+func (client *TCPClient) isClosed() bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.userClosed || client.shuttingDown
+}
+
 func (client *TCPClient) Endpoint() string {
 	return client.endpoint
 }
 
 func (client *TCPClient) Connect() bool {
+	client.connectMutex.Lock()
+	defer client.connectMutex.Unlock()
 
-	conn := newTCPConnection(client.logger, client.onConnected, client.onClosed, client.questProcessor, client.keepAliveParams)
-	if client.serverKey != nil {
-		if ok := conn.enableEncryptor(client.aesKeyBits, client.serverKey); !ok {
-			return ok
+	client.mutex.Lock()
+	client.shuttingDown = false
+	client.mutex.Unlock()
+
+	return client.realConnect()
+}
+
+func (client *TCPClient) realConnect() bool {
+
+	//-- Fails while Close() is waiting for the goroutines.
+	if !client.routines.openGate() {
+		return false
+	}
+
+	logger := client.activeLeveledLogger()
+
+	var conn *tcpConnection
+	onClosed := func(connId uint64, endpoint string) {
+		client.mutex.Lock()
+		userOnClosed := client.onClosed
+		client.mutex.Unlock()
+
+		if userOnClosed != nil {
+			userOnClosed(connId, endpoint)
 		}
+		client.connectionClosed(conn)
 	}
 
 	client.mutex.Lock()
-	defer client.mutex.Unlock()
 
+	options := &connectionOptions{
+		questTimeout:      client.timeout,
+		netChanBufferSize: client.options.chanBufferSize,
+		maxPayloadSize:    client.options.maxPayloadSize,
+	}
+	conn = newTCPConnection(logger, client.onConnected, onClosed, client.questProcessor, client.keepAliveParams, options)
+	conn.routines = &client.routines
+	conn.trySend = client.trySend
+	conn.events = client.emitEvent
+	conn.executor = client.connectionExecutor()
+	conn.questPool = client.questPool
+	conn.middlewares = client.middlewares
+	conn.tracing = client.tracing
+	conn.stats = &client.stats
+	conn.onConnectedInfo = client.onConnectedInfo
+	conn.onClosedInfo = client.onClosedInfo
+	if client.writeBatch != nil {
+		conn.writeBatch = *client.writeBatch
+	}
+	serverKey := client.serverKey
+	aesKeyBits := client.aesKeyBits
+	endpoint := client.endpoint
+	connectTimeout := client.connectTimeout
+	client.mutex.Unlock()
+
+	if serverKey != nil {
+		if ok := conn.enableEncryptor(aesKeyBits, serverKey); !ok {
+			return ok
+		}
+	}
+
+	client.mutex.Lock()
 	if client.conn != nil && client.conn.isConnected() {
+		client.mutex.Unlock()
 		return true
 	}
 
 	client.conn = conn
-	ok := conn.connect(client.endpoint, client.connectTimeout)
+	client.userClosed = false
+	client.mutex.Unlock()
 
+	ok := conn.connect(endpoint, connectTimeout)
+	if ok {
+		client.flushOfflineQueue(conn)
+	}
 	return ok
 }
 
@@ -212,14 +371,21 @@ func (client *TCPClient) Dial() bool {
 	return client.Connect()
 }
 
-func (client *TCPClient) checkConnection() *tcpConnection {
+func (client *TCPClient) checkConnection() (*tcpConnection, error) {
+
+	//-- Checked for every attempt, so retried, hedged and flushed quests are not sent or reconnected during shutdown.
+	if client.isShuttingDown() {
+		return nil, ErrClientShutdown
+	}
 
 	ok := client.IsConnected()
 	if !ok {
-		if client.autoReconnect {
-			ok = client.Connect()
+		if client.GetAutoReconnect() {
+			if err := client.reconnectWithPolicy(client.getReconnectPolicy(), false); err != nil {
+				return nil, err
+			}
 		} else {
-			return nil
+			return nil, errors.New("Connection is invalid.")
 		}
 	}
 
@@ -227,15 +393,82 @@ func (client *TCPClient) checkConnection() *tcpConnection {
 	defer client.mutex.Unlock()
 
 	if client.conn != nil && client.conn.isConnected() {
-		return client.conn
+		return client.conn, nil
 	}
-	return nil
+	return nil, errors.New("Connection is invalid.")
 }
 
-func (client *TCPClient) realSendQuest(quest *Quest, cb *connCallback) error {
-	conn := client.checkConnection()
-	if conn == nil {
-		return errors.New("Connection is invalid.")
+func (client *TCPClient) realSendQuest(quest *Quest, cb *connCallback, handle *QuestHandle) error {
+	quest.handle = handle
+
+	if tracing := client.getTracing(); tracing != nil {
+		return client.sendQuestWithTracing(quest, cb, tracing)
+	}
+	return client.interceptQuest(quest, cb)
+}
+
+func (client *TCPClient) interceptQuest(quest *Quest, cb *connCallback) error {
+	if interceptors := client.getQuestInterceptors(); len(interceptors) > 0 {
+		return client.sendQuestWithInterceptors(quest, cb, interceptors)
+	}
+	return client.invokeQuest(quest, cb)
+}
+
+func (client *TCPClient) invokeQuest(quest *Quest, cb *connCallback) error {
+	if controller := client.getFlowController(quest.method); controller != nil {
+		return client.sendQuestWithFlowControl(quest, cb, controller)
+	}
+	return client.sendQuestWithPolicies(quest, cb)
+}
+
+func (client *TCPClient) sendQuestWithPolicies(quest *Quest, cb *connCallback) error {
+	if cb != nil && quest.isTwoWay {
+		if policy := client.getRetryPolicy(quest.method); policy != nil {
+			return client.sendQuestWithRetry(quest, cb, policy)
+		}
+	}
+	return client.sendQuestAttempt(quest, cb)
+}
+
+func (client *TCPClient) sendQuestOnce(quest *Quest, cb *connCallback) error {
+	breaker := client.getCircuitBreaker()
+	var probe uint64
+	if breaker != nil {
+		var err error
+		if probe, err = breaker.allow(); err != nil {
+			return err
+		}
+
+		if cb != nil {
+			cb.breaker = breaker
+			cb.breakerProbe = probe
+		}
+	}
+
+	err := client.transmitQuest(quest, cb)
+	if breaker != nil {
+		if errors.Is(err, ErrQuestCancelled) {
+			breaker.release(probe)
+		} else if err != nil {
+			breaker.record(FPNN_EC_CORE_SEND_ERROR, probe)
+		} else if cb == nil {
+			breaker.record(FPNN_EC_OK, probe)
+		}
+	}
+	return err
+}
+
+func (client *TCPClient) transmitQuest(quest *Quest, cb *connCallback) error {
+	if quest.handle.isCancelled() {
+		return ErrQuestCancelled
+	}
+
+	conn, err := client.checkConnection()
+	if err != nil {
+		if client.GetAutoReconnect() && client.offlineQueue.enabled() && !errors.Is(err, ErrReconnectExhausted) && !errors.Is(err, ErrClientShutdown) {
+			return client.enqueueOfflineQuest(quest, cb)
+		}
+		return err
 	}
 	return conn.sendQuest(quest, cb)
 }
@@ -243,22 +476,22 @@ func (client *TCPClient) realSendQuest(quest *Quest, cb *connCallback) error {
 func (client *TCPClient) SendQuest(quest *Quest, timeout ...time.Duration) (*Answer, error) {
 
 	if !quest.isTwoWay {
-		err := client.realSendQuest(quest, nil)
+		err := client.realSendQuest(quest, nil, nil)
 		return nil, err
 	}
 
 	//------------ send two way quest ---------------//
-	realTimeout := client.timeout
+	realTimeout := client.defaultQuestTimeout()
 	if len(timeout) == 1 && timeout[0] != 0 {
 		realTimeout = timeout[0]
 	} else if len(timeout) > 1 {
 		panic("Invalid params when call FPNN.TCPCLient.SendQuest() function.")
 	}
 
-	answerChan := make(chan *Answer)
+	answerChan := make(chan *Answer, 1)
 
 	cb := &connCallback{}
-	cb.timeout = time.Now().Unix() + int64(realTimeout/time.Second)
+	cb.deadline = time.Now().Add(realTimeout)
 	cb.callbackFunc = func(answer *Answer, errorCode int) {
 		if answer == nil {
 			answer = newErrorAnswerWitSeqNum(quest.seqNum, errorCode, "")
@@ -267,7 +500,7 @@ func (client *TCPClient) SendQuest(quest *Quest, timeout ...time.Duration) (*Ans
 		answerChan <- answer
 	}
 
-	err := client.realSendQuest(quest, cb)
+	err := client.realSendQuest(quest, cb, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -279,7 +512,7 @@ func (client *TCPClient) SendQuest(quest *Quest, timeout ...time.Duration) (*Ans
 
 func (client *TCPClient) SendQuestWithCallback(quest *Quest, callback AnswerCallback, timeout ...time.Duration) error {
 
-	realTimeout := client.timeout
+	realTimeout := client.defaultQuestTimeout()
 	if len(timeout) == 1 && timeout[0] != 0 {
 		realTimeout = timeout[0]
 	} else if len(timeout) > 1 {
@@ -291,16 +524,16 @@ func (client *TCPClient) SendQuestWithCallback(quest *Quest, callback AnswerCall
 	if quest.isTwoWay {
 		cb = &connCallback{}
 
-		cb.timeout = time.Now().Unix() + int64(realTimeout/time.Second)
+		cb.deadline = time.Now().Add(realTimeout)
 		cb.callback = callback
 	}
 
-	return client.realSendQuest(quest, cb)
+	return client.realSendQuest(quest, cb, nil)
 }
 
 func (client *TCPClient) SendQuestWithLambda(quest *Quest, callback func(answer *Answer, errorCode int), timeout ...time.Duration) error {
 
-	realTimeout := client.timeout
+	realTimeout := client.defaultQuestTimeout()
 	if len(timeout) == 1 && timeout[0] != 0 {
 		realTimeout = timeout[0]
 	} else if len(timeout) > 1 {
@@ -312,21 +545,45 @@ func (client *TCPClient) SendQuestWithLambda(quest *Quest, callback func(answer
 	if quest.isTwoWay {
 		cb = &connCallback{}
 
-		cb.timeout = time.Now().Unix() + int64(realTimeout/time.Second)
+		cb.deadline = time.Now().Add(realTimeout)
 		cb.callbackFunc = callback
 	}
 
-	return client.realSendQuest(quest, cb)
+	return client.realSendQuest(quest, cb, nil)
+}
+
+func (client *TCPClient) dropPendingQuest(quest *Quest, cb *connCallback) {
+	removed := client.offlineQueue.remove(quest) != nil
+	if !removed {
+		client.mutex.Lock()
+		conn := client.conn
+		client.mutex.Unlock()
+
+		removed = conn != nil && conn.dropQuestCallback(quest, cb)
+	}
+
+	if removed && cb.breaker != nil {
+		cb.breaker.release(cb.breakerProbe)
+	}
 }
 
 func (client *TCPClient) Close() {
+	//-- Closed first, so the connection started by a concurrent Connect() is either closed here, or not started.
+	client.routines.closeGate()
+
 	client.mutex.Lock()
 
 	conn := client.conn
 	client.conn = nil
+	client.userClosed = true
 	client.mutex.Unlock()
 
+	client.reconnect.stopLoop()
+	client.offlineQueue.failAll(FPNN_EC_CORE_CONNECTION_CLOSED, "Connection is closed.")
+	client.routines.fireTimers()
+
 	if conn != nil {
-		conn.close()
+		conn.closeWithReason(CloseReasonUserClose, nil)
 	}
+	client.routines.wait()
 }
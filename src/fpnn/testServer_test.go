@@ -0,0 +1,174 @@
+package fpnn
+
+import (
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"testing"
+)
+
+type testServer struct {
+	listener net.Listener
+	handler  func(quest *Quest) *Answer
+	mutex    sync.Mutex
+	conns    map[net.Conn]*sync.Mutex
+	accepted int
+	answers  chan *Answer
+	wg       sync.WaitGroup
+}
+
+func newTestServer(t *testing.T, handler func(quest *Quest) *Answer) *testServer {
+	return newTestServerAt(t, "127.0.0.1:0", handler)
+}
+
+func newTestServerAt(t *testing.T, endpoint string, handler func(quest *Quest) *Answer) *testServer {
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+
+	server := &testServer{listener: listener, handler: handler, conns: make(map[net.Conn]*sync.Mutex), answers: make(chan *Answer, 64)}
+	server.wg.Add(1)
+	go server.acceptLoop()
+
+	t.Cleanup(server.stop)
+	return server
+}
+
+func (server *testServer) endpoint() string {
+	return server.listener.Addr().String()
+}
+
+func (server *testServer) acceptedCount() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.accepted
+}
+
+func (server *testServer) acceptLoop() {
+	defer server.wg.Done()
+
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		server.mutex.Lock()
+		writeMutex := &sync.Mutex{}
+		server.conns[conn] = writeMutex
+		server.accepted += 1
+		server.mutex.Unlock()
+
+		server.wg.Add(1)
+		go server.serve(conn, writeMutex)
+	}
+}
+
+func (server *testServer) serve(conn net.Conn, writeMutex *sync.Mutex) {
+	defer server.wg.Done()
+	defer server.closeConn(conn)
+
+	for {
+		data := &rawData{header: make([]byte, 12)}
+		if _, err := io.ReadFull(conn, data.header); err != nil {
+			return
+		}
+
+		payloadSize := binary.LittleEndian.Uint32(data.header[8:])
+		switch data.header[6] {
+		case MessageTypeOneWay:
+			data.body = make([]byte, payloadSize+uint32(data.header[7]))
+		case MessageTypeTwoWay:
+			data.body = make([]byte, payloadSize+4+uint32(data.header[7]))
+		default:
+			data.body = make([]byte, payloadSize+4)
+		}
+
+		if _, err := io.ReadFull(conn, data.body); err != nil {
+			return
+		}
+
+		if data.header[6] == MessageTypeAnswer {
+			if answer, err := NewAnswerWithRawData(data); err == nil {
+				select {
+				case server.answers <- answer:
+				default:
+				}
+			}
+			continue
+		}
+
+		quest, err := NewQuestWithRawData(data)
+		if err != nil {
+			return
+		}
+
+		go func() {
+			answer := server.handler(quest)
+			if answer == nil || !quest.isTwoWay {
+				return
+			}
+
+			binData, err := answer.Raw()
+			if err != nil {
+				return
+			}
+
+			writeMutex.Lock()
+			conn.Write(binData)
+			writeMutex.Unlock()
+		}()
+	}
+}
+
+func (server *testServer) closeConn(conn net.Conn) {
+	server.mutex.Lock()
+	delete(server.conns, conn)
+	server.mutex.Unlock()
+
+	conn.Close()
+}
+
+// Sends the quest to all connected clients. Answers are delivered to server.answers.
+func (server *testServer) pushQuest(t *testing.T, quest *Quest) {
+	binData, err := quest.Raw()
+	if err != nil {
+		t.Fatalf("encode quest failed: %v", err)
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	for conn, writeMutex := range server.conns {
+		writeMutex.Lock()
+		conn.Write(binData)
+		writeMutex.Unlock()
+	}
+}
+
+func (server *testServer) dropConnections() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	for conn := range server.conns {
+		conn.Close()
+	}
+}
+
+func (server *testServer) stop() {
+	server.listener.Close()
+	server.dropConnections()
+	server.wg.Wait()
+}
+
+func echoHandler(quest *Quest) *Answer {
+	answer := NewAnswer(quest)
+	answer.Payload = quest.Payload
+	return answer
+}
+
+var testLogger = log.New(io.Discard, "", 0)
@@ -0,0 +1,229 @@
+package fpnn
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+const DefaultTracePayloadKey = "traceContext"
+
+type SpanKind int
+
+const (
+	SpanKindClient SpanKind = iota
+	SpanKindServer
+)
+
+/*
+Span is a traced operation. SetStatus is called with the FPNN error code before End,
+FPNN_EC_OK for succeeded quests.
+*/
+type Span interface {
+	SetAttribute(key string, value interface{})
+	SetStatus(code int, description string)
+	End()
+}
+
+/*
+Tracer starts spans, and propagates the trace context through carriers.
+The carrier holds the W3C trace context fields, e.g. "traceparent" and "tracestate".
+*/
+type Tracer interface {
+	Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span)
+	Inject(ctx context.Context, carrier map[string]string)
+	Extract(ctx context.Context, carrier map[string]string) context.Context
+}
+
+type tracingConfig struct {
+	tracer     Tracer
+	payloadKey string
+}
+
+/*
+A client span is started around each sent quest, whose parent is quest.Context(),
+and the trace context is injected into the payload of the quest with payloadKey.
+
+For incoming quests, the trace context is extracted from payloadKey before calling the handler,
+and a server span is started around the handler and the middlewares. The handler gets it by quest.Context().
+For deferred answers, the server span ends when the answer is sent by the QuestResponder.
+
+payloadKey is a reserved field of the payload: the field of the same name set by the caller is overwritten.
+
+If payloadKey is empty, DefaultTracePayloadKey is used. Set nil tracer to disable.
+*/
+func (client *TCPClient) SetTracer(tracer Tracer, payloadKey string) {
+	var tracing *tracingConfig
+	if tracer != nil {
+		if len(payloadKey) == 0 {
+			payloadKey = DefaultTracePayloadKey
+		}
+		tracing = &tracingConfig{tracer: tracer, payloadKey: payloadKey}
+	}
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.tracing = tracing
+	if client.conn != nil {
+		client.conn.setTracing(tracing)
+	}
+}
+
+func (client *TCPClient) getTracing() *tracingConfig {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.tracing
+}
+
+func (conn *tcpConnection) setTracing(tracing *tracingConfig) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	conn.tracing = tracing
+}
+
+// Ends the span only once, as a failed sending may have called the callback.
+type questSpan struct {
+	span  Span
+	ended int32
+}
+
+func (span *questSpan) end(code int, description string) {
+	if atomic.CompareAndSwapInt32(&span.ended, 0, 1) {
+		span.span.SetStatus(code, description)
+		span.span.End()
+	}
+}
+
+func setQuestSpanAttributes(span Span, quest *Quest) {
+	span.SetAttribute("rpc.system", "fpnn")
+	span.SetAttribute("rpc.method", quest.method)
+	span.SetAttribute("fpnn.two_way", quest.isTwoWay)
+}
+
+func answerSpanStatus(answer *Answer) (int, string) {
+	if answer != nil && answer.IsException() {
+		code, _ := answer.GetInt("code")
+		return answerStatus(answer, code)
+	}
+	return FPNN_EC_OK, ""
+}
+
+func answerStatus(answer *Answer, errorCode int) (int, string) {
+	if answer == nil || errorCode == FPNN_EC_OK {
+		return errorCode, ""
+	}
+
+	ex, _ := answer.GetString("ex")
+	return errorCode, ex
+}
+
+func (client *TCPClient) sendQuestWithTracing(quest *Quest, cb *connCallback, tracing *tracingConfig) error {
+
+	ctx, span := tracing.tracer.Start(quest.Context(), quest.method, SpanKindClient)
+	setQuestSpanAttributes(span, quest)
+	span.SetAttribute("server.address", client.endpoint)
+
+	carrier := make(map[string]string)
+	tracing.tracer.Inject(ctx, carrier)
+	if len(carrier) > 0 {
+		quest.Param(tracing.payloadKey, carrier)
+	}
+
+	qs := &questSpan{span: span}
+
+	var wrapped *connCallback
+	if cb != nil {
+		wrapped = &connCallback{}
+		wrapped.deadline = cb.deadline
+		wrapped.callbackFunc = func(answer *Answer, errorCode int) {
+			qs.end(answerStatus(answer, errorCode))
+			callAnswerCallback(answer, cb)
+		}
+	}
+
+	if err := client.interceptQuest(quest, wrapped); err != nil {
+		qs.end(FPNN_EC_CORE_UNKNOWN_ERROR, err.Error())
+		return err
+	}
+
+	if cb == nil {
+		qs.end(FPNN_EC_OK, "")
+	}
+	return nil
+}
+
+//-----------------[ incoming quests ]-----------------//
+
+func extractTraceCarrier(quest *Quest, payloadKey string) map[string]string {
+	value, ok := quest.Get(payloadKey)
+	if !ok {
+		return nil
+	}
+
+	carrier := make(map[string]string)
+	switch fields := value.(type) {
+	case map[string]string:
+		for key, field := range fields {
+			carrier[key] = field
+		}
+	case map[interface{}]interface{}:
+		for key, field := range fields {
+			name, ok1 := key.(string)
+			text, ok2 := field.(string)
+			if ok1 && ok2 {
+				carrier[name] = text
+			}
+		}
+	case map[string]interface{}:
+		for key, field := range fields {
+			if text, ok := field.(string); ok {
+				carrier[key] = text
+			}
+		}
+	}
+	return carrier
+}
+
+func newTracingMiddleware(tracing *tracingConfig) QuestMiddleware {
+	return func(next QuestHandler) QuestHandler {
+		return func(quest *Quest) (answer *Answer, err error) {
+			ctx := quest.Context()
+			if carrier := extractTraceCarrier(quest, tracing.payloadKey); len(carrier) > 0 {
+				ctx = tracing.tracer.Extract(ctx, carrier)
+			}
+
+			ctx, span := tracing.tracer.Start(ctx, quest.method, SpanKindServer)
+			setQuestSpanAttributes(span, quest)
+			quest.ctx = ctx
+
+			qs := &questSpan{span: span}
+			quest.answerSent = func(answer *Answer) {
+				qs.end(answerSpanStatus(answer))
+			}
+
+			defer func() {
+				if r := recover(); r != nil {
+					qs.end(FPNN_EC_CORE_UNKNOWN_ERROR, fmt.Sprintf("Process quest panic: %v", r))
+					panic(r)
+				}
+			}()
+
+			answer, err = next(quest)
+
+			//-- The deferred answer is sent by the QuestResponder later, which ends the span.
+			if quest.isDeferred() && answer == nil {
+				return answer, err
+			}
+
+			if err != nil {
+				qs.end(FPNN_EC_CORE_UNKNOWN_ERROR, err.Error())
+			} else {
+				qs.end(answerSpanStatus(answer))
+			}
+			return answer, err
+		}
+	}
+}
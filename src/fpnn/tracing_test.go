@@ -0,0 +1,182 @@
+package fpnn
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingExporter struct {
+	mutex sync.Mutex
+	spans []*SpanData
+}
+
+func (exporter *recordingExporter) ExportSpan(span *SpanData) {
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+
+	exporter.spans = append(exporter.spans, span)
+}
+
+func (exporter *recordingExporter) take() []*SpanData {
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+
+	spans := exporter.spans
+	exporter.spans = nil
+	return spans
+}
+
+func TestParseTraceParent(t *testing.T) {
+	valid := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if sc, ok := parseTraceParent(valid); !ok || sc.traceID != "4bf92f3577b34da6a3ce929d0e0e4736" || !sc.sampled() {
+		t.Fatalf("parse %s failed", valid)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, ok := parseTraceParent(invalid); ok {
+			t.Fatalf("invalid traceparent %q is accepted", invalid)
+		}
+	}
+
+	if _, ok := parseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); !ok {
+		t.Fatalf("traceparent of future version is rejected")
+	}
+}
+
+func TestQuestTracing(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	exporter := &recordingExporter{}
+	tracer := NewW3CTracer(exporter)
+
+	contexts := make(chan context.Context, 1)
+	router := NewQuestRouter()
+	router.Handle("push", func(quest *Quest) (*Answer, error) {
+		contexts <- quest.Context()
+		return NewErrorAnswer(quest, FPNN_EC_CORE_FORBIDDEN, "forbidden"), nil
+	})
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetTracer(tracer, "trace")
+	client.SetQuestProcessor(router)
+	defer client.Close()
+
+	//-- Client span, whose parent is the span in ctx.
+	ctx, parent := tracer.Start(context.Background(), "parent", SpanKindClient)
+	answer, err := client.SendQuestWithContext(ctx, NewQuest("echo"), 2*time.Second)
+	if err != nil || answer.IsException() {
+		t.Fatalf("send quest failed, err: %v", err)
+	}
+	parent.End()
+
+	carrier, _ := answer.GetDict("trace")
+	traceParent, _ := carrier.GetString("traceparent")
+
+	spans := exporter.take()
+	if len(spans) != 2 {
+		t.Fatalf("unexpected spans: %d", len(spans))
+	}
+
+	span := spans[0]
+	if span.Name != "echo" || span.Kind != SpanKindClient || span.StatusCode != FPNN_EC_OK || span.Attributes["rpc.method"] != "echo" {
+		t.Fatalf("unexpected client span: %+v", span)
+	}
+	if span.ParentSpanID != spans[1].SpanID || span.TraceID != spans[1].TraceID {
+		t.Fatalf("client span is not the child of the span in ctx")
+	}
+	if traceParent != "00-"+span.TraceID+"-"+span.SpanID+"-01" {
+		t.Fatalf("unexpected injected traceparent: %s", traceParent)
+	}
+
+	//-- Server span of pushed quest.
+	remoteTraceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	quest := NewQuest("push")
+	quest.seqNum = 1
+	quest.Param("trace", map[string]string{
+		"traceparent": "00-" + remoteTraceID + "-00f067aa0ba902b7-01",
+		"tracestate":  "vendor=value",
+	})
+	server.pushQuest(t, quest)
+	waitServerAnswer(t, server)
+
+	traceID, spanID, ok := W3CSpanContext(<-contexts)
+	if !ok || traceID != remoteTraceID {
+		t.Fatalf("trace context is not extracted: %s", traceID)
+	}
+
+	spans = exporter.take()
+	if len(spans) != 1 {
+		t.Fatalf("unexpected spans: %d", len(spans))
+	}
+
+	span = spans[0]
+	if span.Kind != SpanKindServer || span.SpanID != spanID || span.ParentSpanID != "00f067aa0ba902b7" || !span.Remote {
+		t.Fatalf("unexpected server span: %+v", span)
+	}
+	if span.TraceState != "vendor=value" || span.StatusCode != FPNN_EC_CORE_FORBIDDEN || !strings.Contains(span.StatusMessage, "forbidden") {
+		t.Fatalf("unexpected server span status: %+v", span)
+	}
+
+	//-- Failed sending ends the span.
+	client.SetAutoReconnect(false)
+	client.Close()
+	if err := client.SendQuestWithLambda(NewQuest("closed"), func(answer *Answer, errorCode int) {}); err == nil {
+		t.Fatalf("send quest on closed client succeeded")
+	}
+	if spans = exporter.take(); len(spans) != 1 || spans[0].StatusCode != FPNN_EC_CORE_UNKNOWN_ERROR {
+		t.Fatalf("failed sending is not traced")
+	}
+}
+
+func TestDeferredAnswerTracing(t *testing.T) {
+	server := newTestServer(t, echoHandler)
+
+	exporter := &recordingExporter{}
+	responders := make(chan *QuestResponder, 1)
+	router := NewQuestRouter()
+	router.Handle("deferred", func(quest *Quest) (*Answer, error) {
+		responders <- quest.DeferAnswer()
+		return nil, nil
+	})
+
+	client := NewTCPClient(server.endpoint())
+	client.SetLogger(testLogger)
+	client.SetTracer(NewW3CTracer(exporter), "")
+	client.SetQuestProcessor(router)
+	defer client.Close()
+
+	if !client.Connect() {
+		t.Fatalf("connect failed")
+	}
+
+	quest := NewQuest("deferred")
+	quest.seqNum = 1
+	server.pushQuest(t, quest)
+	responder := <-responders
+
+	time.Sleep(100 * time.Millisecond)
+	if spans := exporter.take(); len(spans) != 0 {
+		t.Fatalf("server span ends before the deferred answer is sent")
+	}
+
+	if err := responder.SendErrorAnswer(FPNN_EC_CORE_FORBIDDEN, "forbidden"); err != nil {
+		t.Fatalf("send deferred answer failed, err: %v", err)
+	}
+	waitServerAnswer(t, server)
+
+	spans := exporter.take()
+	if len(spans) != 1 || spans[0].Kind != SpanKindServer || spans[0].StatusCode != FPNN_EC_CORE_FORBIDDEN {
+		t.Fatalf("unexpected server spans: %+v", spans)
+	}
+}
@@ -0,0 +1,218 @@
+package fpnn
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+SpanData follows the span model of OpenTelemetry. IDs are lowercase hex strings,
+and ParentSpanID is empty for root spans.
+*/
+type SpanData struct {
+	TraceID       string
+	SpanID        string
+	ParentSpanID  string
+	TraceState    string
+	Name          string
+	Kind          SpanKind
+	StartTime     time.Time
+	EndTime       time.Time
+	Attributes    map[string]interface{}
+	StatusCode    int
+	StatusMessage string
+	Remote        bool
+}
+
+/*
+SpanExporter receives the ended spans which are sampled. It must be safe for concurrent use.
+*/
+type SpanExporter interface {
+	ExportSpan(span *SpanData)
+}
+
+type w3cSpanContext struct {
+	traceID    string
+	spanID     string
+	flags      string
+	traceState string
+	remote     bool
+}
+
+func (sc w3cSpanContext) sampled() bool {
+	flags, err := hex.DecodeString(sc.flags)
+	return err == nil && len(flags) == 1 && flags[0]&0x01 != 0
+}
+
+type w3cSpanContextKey struct{}
+
+/*
+W3CTracer is a reference Tracer, which propagates W3C trace context by "traceparent" and "tracestate",
+and hands the ended spans to a SpanExporter.
+New traces are always sampled, and child spans follow the sampled flag of the parent.
+*/
+type W3CTracer struct {
+	exporter SpanExporter
+}
+
+func NewW3CTracer(exporter SpanExporter) *W3CTracer {
+	return &W3CTracer{exporter: exporter}
+}
+
+/*
+Returns the trace id and span id of the current span in ctx.
+*/
+func W3CSpanContext(ctx context.Context) (traceID string, spanID string, ok bool) {
+	sc, ok := ctx.Value(w3cSpanContextKey{}).(w3cSpanContext)
+	return sc.traceID, sc.spanID, ok
+}
+
+func randomHexID(size int) string {
+	id := make([]byte, size)
+	for {
+		if _, err := rand.Read(id); err != nil {
+			panic(err)
+		}
+
+		for _, b := range id {
+			if b != 0 {
+				return hex.EncodeToString(id)
+			}
+		}
+	}
+}
+
+func (tracer *W3CTracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+
+	parent, hasParent := ctx.Value(w3cSpanContextKey{}).(w3cSpanContext)
+
+	sc := w3cSpanContext{spanID: randomHexID(8), flags: "01"}
+	span := &w3cSpan{exporter: tracer.exporter}
+	span.data.Name = name
+	span.data.Kind = kind
+	span.data.StartTime = time.Now()
+	span.data.Attributes = make(map[string]interface{})
+
+	if hasParent {
+		sc.traceID = parent.traceID
+		sc.flags = parent.flags
+		sc.traceState = parent.traceState
+		span.data.ParentSpanID = parent.spanID
+		span.data.Remote = parent.remote
+	} else {
+		sc.traceID = randomHexID(16)
+	}
+
+	span.data.TraceID = sc.traceID
+	span.data.SpanID = sc.spanID
+	span.data.TraceState = sc.traceState
+	span.sampled = sc.sampled()
+
+	return context.WithValue(ctx, w3cSpanContextKey{}, sc), span
+}
+
+func (tracer *W3CTracer) Inject(ctx context.Context, carrier map[string]string) {
+	sc, ok := ctx.Value(w3cSpanContextKey{}).(w3cSpanContext)
+	if !ok {
+		return
+	}
+
+	carrier["traceparent"] = "00-" + sc.traceID + "-" + sc.spanID + "-" + sc.flags
+	if len(sc.traceState) > 0 {
+		carrier["tracestate"] = sc.traceState
+	}
+}
+
+func (tracer *W3CTracer) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	sc, ok := parseTraceParent(carrier["traceparent"])
+	if !ok {
+		return ctx
+	}
+
+	sc.traceState = carrier["tracestate"]
+	sc.remote = true
+	return context.WithValue(ctx, w3cSpanContextKey{}, sc)
+}
+
+func isLowerHex(text string, size int) bool {
+	if len(text) != size {
+		return false
+	}
+
+	for _, c := range text {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Format: version "-" trace-id "-" parent-id "-" trace-flags. Fields after the flags are allowed for future versions.
+func parseTraceParent(traceParent string) (w3cSpanContext, bool) {
+	fields := strings.Split(traceParent, "-")
+	if len(fields) < 4 || !isLowerHex(fields[0], 2) || fields[0] == "ff" {
+		return w3cSpanContext{}, false
+	}
+
+	if fields[0] == "00" && len(fields) != 4 {
+		return w3cSpanContext{}, false
+	}
+
+	sc := w3cSpanContext{traceID: fields[1], spanID: fields[2], flags: fields[3]}
+	if !isLowerHex(sc.traceID, 32) || !isLowerHex(sc.spanID, 16) || !isLowerHex(sc.flags, 2) {
+		return w3cSpanContext{}, false
+	}
+
+	if sc.traceID == strings.Repeat("0", 32) || sc.spanID == strings.Repeat("0", 16) {
+		return w3cSpanContext{}, false
+	}
+	return sc, true
+}
+
+type w3cSpan struct {
+	mutex    sync.Mutex
+	data     SpanData
+	exporter SpanExporter
+	sampled  bool
+	ended    bool
+}
+
+func (span *w3cSpan) SetAttribute(key string, value interface{}) {
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+
+	if !span.ended {
+		span.data.Attributes[key] = value
+	}
+}
+
+func (span *w3cSpan) SetStatus(code int, description string) {
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+
+	if !span.ended {
+		span.data.StatusCode = code
+		span.data.StatusMessage = description
+	}
+}
+
+func (span *w3cSpan) End() {
+	span.mutex.Lock()
+	if span.ended {
+		span.mutex.Unlock()
+		return
+	}
+
+	span.ended = true
+	span.data.EndTime = time.Now()
+	data := span.data
+	span.mutex.Unlock()
+
+	if span.sampled && span.exporter != nil {
+		span.exporter.ExportSpan(&data)
+	}
+}
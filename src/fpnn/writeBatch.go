@@ -0,0 +1,151 @@
+package fpnn
+
+import (
+	"net"
+	"time"
+)
+
+type writeBatchParams struct {
+	maxFrames    int
+	maxBytes     int
+	flushLatency time.Duration
+}
+
+var defaultWriteBatchParams = writeBatchParams{
+	maxFrames:    64,
+	maxBytes:     256 * 1024,
+	flushLatency: 0,
+}
+
+type writeBatch struct {
+	frames   net.Buffers
+	size     int
+	buffer   []byte
+	barriers []chan struct{}
+}
+
+func (batch *writeBatch) reset() {
+	for i := range batch.frames {
+		batch.frames[i] = nil
+	}
+	batch.frames = batch.frames[:0]
+	batch.size = 0
+	batch.barriers = batch.barriers[:0]
+}
+
+// Frames of cancelled quests are dropped. A barrier ends the batch, and is released after the batch is written.
+func (batch *writeBatch) append(frame writeFrame) {
+	if frame.flushed != nil {
+		batch.barriers = append(batch.barriers, frame.flushed)
+		return
+	}
+
+	if frame.handle.isCancelled() {
+		return
+	}
+
+	batch.frames = append(batch.frames, frame.data)
+	batch.size += len(frame.data)
+}
+
+func (batch *writeBatch) full(params *writeBatchParams) bool {
+	return len(batch.frames) >= params.maxFrames || batch.size >= params.maxBytes || len(batch.barriers) > 0
+}
+
+func (batch *writeBatch) releaseBarriers() {
+	for _, flushed := range batch.barriers {
+		close(flushed)
+	}
+}
+
+// Collects the frames already queued, and waits at most flushLatency for more frames.
+func (conn *tcpConnection) collectWriteBatch(batch *writeBatch) {
+
+	params := &conn.writeBatch
+	var timer *time.Timer
+
+	for !batch.full(params) {
+		select {
+		case frame := <-conn.writeChan:
+			batch.append(frame)
+			continue
+		default:
+		}
+
+		if params.flushLatency <= 0 {
+			break
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(params.flushLatency)
+			defer timer.Stop()
+		}
+
+		select {
+		case frame := <-conn.writeChan:
+			batch.append(frame)
+			continue
+		case <-timer.C:
+		case <-conn.closedChan:
+		}
+		break
+	}
+}
+
+func (conn *tcpConnection) flushWriteBatch(batch *writeBatch, encoder *encryptor) error {
+
+	if encoder == nil {
+		if len(batch.frames) == 1 {
+			written, err := conn.conn.Write(batch.frames[0])
+			conn.stats.recordSent(written, 1)
+			return err
+		}
+
+		frames := batch.frames
+		count := len(frames)
+		written, err := frames.WriteTo(conn.conn)
+		conn.stats.recordSent(int(written), count)
+		return err
+	}
+
+	if cap(batch.buffer) < batch.size {
+		batch.buffer = make([]byte, 0, batch.size)
+	}
+
+	buffer := batch.buffer[:0]
+	for _, frame := range batch.frames {
+		buffer = append(buffer, frame...)
+	}
+
+	encoder.encryptInPlace(buffer)
+	written, err := conn.conn.Write(buffer)
+	conn.stats.recordSent(written, len(batch.frames))
+
+	if cap(batch.buffer) > 4*defaultWriteBatchParams.maxBytes {
+		batch.buffer = nil
+	}
+	return err
+}
+
+//-----------------[ TCPClient write batch ]-----------------//
+
+/*
+Frames already queued are coalesced into one write, up to maxFrames frames or maxBytes bytes.
+If flushLatency > 0, the connection waits at most flushLatency for more frames before writing.
+*/
+func (client *TCPClient) SetWriteBatch(maxFrames int, maxBytes int, flushLatency time.Duration) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	params := defaultWriteBatchParams
+	if maxFrames > 0 {
+		params.maxFrames = maxFrames
+	}
+	if maxBytes > 0 {
+		params.maxBytes = maxBytes
+	}
+	if flushLatency > 0 {
+		params.flushLatency = flushLatency
+	}
+	client.writeBatch = &params
+}